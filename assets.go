@@ -0,0 +1,14 @@
+package main
+
+import "embed"
+
+// assets has the static files and the templates, so the
+// binary serves them from any directory. Set
+// ASSETS_FROM_DISK=true in the .env file to read them from
+// the folders instead, to see the changes without building
+// again during development. go generate writes the .gz
+// copies of the static files before they are embedded.
+//
+//go:generate go run ./cmd/precompress static
+//go:embed static templates
+var assets embed.FS
@@ -0,0 +1,23 @@
+// The precompress command writes the .gz copies of the
+// static files of the folder given as argument, updating
+// the outdated ones. It runs with go generate, before the
+// static files are embedded.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/server"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: precompress <static folder>")
+	}
+	written, err := server.GzipStaticFiles(os.Args[1])
+	if err != nil {
+		log.Fatal("Cannot compress the static files: ", err)
+	}
+	log.Printf("%d static files compressed", written)
+}
@@ -1,5 +1,10 @@
 module github.com/MetalbolicX/vanilla-go-webserver
 
-go 1.20
+go 1.24.0
 
-require github.com/mattn/go-sqlite3 v1.14.16
+require (
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/net v0.50.0
+)
+
+require golang.org/x/text v0.34.0 // indirect
@@ -41,6 +41,14 @@ func (d *relationalDBRepo) Close() error {
 	return d.db.Close()
 }
 
+// The Ping method is part of the Repository interface
+// implementation. It verifies that the database is still
+// reachable, opening a connection if necessary, by
+// invoking the PingContext method of the sql.DB struct.
+func (d *relationalDBRepo) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 // The ExecuteCommand method is part of the Repository
 // interface implementation. It executes a database query
 // with the provided query string and arguments.
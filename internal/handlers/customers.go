@@ -5,10 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
 
 	"github.com/MetalbolicX/vanilla-go-webserver/pkg/repository"
-	"github.com/MetalbolicX/vanilla-go-webserver/pkg/utils"
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/server"
 )
 
 type customerRequest struct {
@@ -58,10 +57,9 @@ func NewCustomerHandler(w http.ResponseWriter, r *http.Request) {
 // For example:
 // curl localhost:3000/customer/1
 func GetCustomerByIdHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the user ID from the request URL
-	idStr := utils.GetIdentifier(r.URL.Path)
-	customerID, err := strconv.Atoi(idStr)
-	if err != nil {
+	// Get the customer ID captured by the router
+	customerID, ok := server.GetParams(r).GetInt("id")
+	if !ok {
 		http.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
@@ -98,17 +96,16 @@ func GetCustomerByIdHandler(w http.ResponseWriter, r *http.Request) {
 // For example:
 // curl -X PUT -H "Content-Type: application/json" -d '{"name": "Jose", "email": "josee@example.com"}' http://localhost:3000/customer/1
 func UpdateCustomerHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the user ID from the request URL
-	idStr := utils.GetIdentifier(r.URL.Path)
-	customerId, err := strconv.Atoi(idStr)
-	if err != nil {
+	// Get the customer ID captured by the router
+	customerId, ok := server.GetParams(r).GetInt("id")
+	if !ok {
 		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
 		return
 	}
 
 	// Parse the request body
 	var customer customerRequest
-	err = json.NewDecoder(r.Body).Decode(&customer)
+	err := json.NewDecoder(r.Body).Decode(&customer)
 	if err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -146,10 +143,9 @@ func UpdateCustomerHandler(w http.ResponseWriter, r *http.Request) {
 // For example:
 // curl -X DELETE localhost:3000/customer/1
 func DeleteCustomerHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the user ID from the request URL
-	idStr := utils.GetIdentifier(r.URL.Path)
-	customerId, err := strconv.Atoi(idStr)
-	if err != nil {
+	// Get the customer ID captured by the router
+	customerId, ok := server.GetParams(r).GetInt("id")
+	if !ok {
 		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
 		return
 	}
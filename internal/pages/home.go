@@ -4,9 +4,12 @@ import (
 	"net/http"
 
 	"github.com/MetalbolicX/vanilla-go-webserver/pkg/render"
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/server"
 	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
 )
 
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
-	render.RenderTemplate(w, "home-page.html", &types.TemplateData{})
+	if err := render.RenderTemplate(w, "home-page.html", &types.TemplateData{}); err != nil {
+		server.InternalError(w, r, err)
+	}
 }
@@ -15,12 +15,19 @@ import (
 // It sets up the routing configuration for
 // various HTTP methods (GET, POST, PUT)
 // and associates each route with its respective handler function.
+// The customer endpoints share the /customer prefix through
+// a group, and the ones which modify data destructively are
+// in a nested group protected by the authentication check.
+// The same routes are declared in routes.json, which is
+// used instead when the ROUTES_FILE variable is set.
 func BindRoutes(s *server.Server) {
-	s.Handle(http.MethodGet, "/", pages.HomeHandler)
-	s.Handle(http.MethodPost, "/customer", handlers.NewCustomerHandler)
-	s.Handle(http.MethodGet, "/customer/\\d+", handlers.GetCustomerByIdHandler)
-	s.Handle(http.MethodPut, "/customer/\\d+", handlers.UpdateCustomerHandler)
-	s.Handle(http.MethodDelete, "/customer/\\d+",
-		s.AddMiddleware(handlers.DeleteCustomerHandler,
-			middlewares.CheckAuth(), middlewares.Logging()))
+	s.Handle(http.MethodGet, "/", pages.HomeHandler).Name("home")
+
+	customers := s.Group("/customer")
+	customers.Handle(http.MethodPost, "", handlers.NewCustomerHandler)
+	customers.Handle(http.MethodGet, "/{id:int}", handlers.GetCustomerByIdHandler).Name("customer")
+	customers.Handle(http.MethodPut, "/{id:int}", handlers.UpdateCustomerHandler)
+
+	protected := customers.Group("", middlewares.CheckAuth())
+	protected.Handle(http.MethodDelete, "/{id:int}", handlers.DeleteCustomerHandler)
 }
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/server"
+)
+
+func TestBindRoutes(t *testing.T) {
+	s := server.NewServer("127.0.0.1:0")
+	BindRoutes(s)
+
+	want := []server.RouteInfo{
+		{Method: "GET", Pattern: "/", Name: "home", Middlewares: []string{}},
+		{Method: "POST", Pattern: "/customer", Middlewares: []string{}},
+		// Only the destructive endpoint is protected.
+		{Method: "DELETE", Pattern: "/customer/{id:int}", Middlewares: []string{"middlewares.CheckAuth"}},
+		{Method: "GET", Pattern: "/customer/{id:int}", Name: "customer", Middlewares: []string{}},
+		{Method: "PUT", Pattern: "/customer/{id:int}", Middlewares: []string{}},
+	}
+	if got := s.Routes(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("BindRoutes registered\n%v\nwant\n%v", got, want)
+	}
+	for name, path := range map[string]string{"home": "/", "customer": "/customer/7"} {
+		var params []any
+		if name == "customer" {
+			params = []any{"id", 7}
+		}
+		if got, err := s.URLFor(name, params...); err != nil || got != path {
+			t.Errorf("URLFor(%q) = (%q, %v), want %s", name, got, err, path)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/MetalbolicX/vanilla-go-webserver/internal/handlers"
+	"github.com/MetalbolicX/vanilla-go-webserver/internal/middlewares"
+	"github.com/MetalbolicX/vanilla-go-webserver/internal/pages"
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/server"
+)
+
+// The NewRegistry function returns the registry with the
+// handlers, middlewares and auth policies of the app, by
+// the names used in the routes file (see routes.json).
+// A new handler must be added here to be used in the file.
+func NewRegistry() *server.Registry {
+	registry := server.NewRegistry()
+	registry.RegisterHandler("home", pages.HomeHandler)
+	registry.RegisterHandler("customers.new", handlers.NewCustomerHandler)
+	registry.RegisterHandler("customers.get", handlers.GetCustomerByIdHandler)
+	registry.RegisterHandler("customers.update", handlers.UpdateCustomerHandler)
+	registry.RegisterHandler("customers.delete", handlers.DeleteCustomerHandler)
+
+	registry.RegisterMiddleware("logging", middlewares.Logging())
+
+	registry.RegisterAuthPolicy("authenticated", middlewares.CheckAuth())
+	return registry
+}
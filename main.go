@@ -1,10 +1,12 @@
 package main
 
 import (
+	"io/fs"
 	"log"
 	"os"
 
 	"github.com/MetalbolicX/vanilla-go-webserver/internal/config"
+	"github.com/MetalbolicX/vanilla-go-webserver/internal/middlewares"
 	"github.com/MetalbolicX/vanilla-go-webserver/internal/routes"
 	"github.com/MetalbolicX/vanilla-go-webserver/pkg/render"
 	"github.com/MetalbolicX/vanilla-go-webserver/pkg/server"
@@ -20,7 +22,49 @@ func main() {
 	DB_URL := os.Getenv("DB_URL")
 	DB_MANAGEMENT_SYSTEM := os.Getenv("DB_MANAGEMENT_SYSTEM")
 	STATIC_FOLDER := os.Getenv("STATIC_FOLDER")
+	ROUTES_FILE := os.Getenv("ROUTES_FILE")
+	ASSETS_FROM_DISK := os.Getenv("ASSETS_FROM_DISK") == "true"
+	STATIC_PRECOMPRESS := os.Getenv("STATIC_PRECOMPRESS") == "true"
 
+	serverOptions, err := server.EnvOptions()
+	if err != nil {
+		log.Fatal("Invalid server configuration: ", err)
+	}
+	serverOptions = append(serverOptions, server.WithCleanPathRedirect(), server.WithTrailingSlashRedirect())
+	if ASSETS_FROM_DISK && STATIC_PRECOMPRESS {
+		written, err := server.GzipStaticFiles("./" + STATIC_FOLDER)
+		if err != nil {
+			log.Fatal("Cannot compress the static files: ", err)
+		}
+		log.Printf("%d static files compressed", written)
+	} else if STATIC_PRECOMPRESS {
+		log.Print("STATIC_PRECOMPRESS is ignored with the embedded assets, run go generate before go build")
+	}
+	server := server.NewServer(PORT, serverOptions...)
+	server.Use(middlewares.Logging())
+	if ROUTES_FILE != "" {
+		if err := server.LoadRoutes(ROUTES_FILE, routes.NewRegistry()); err != nil {
+			log.Fatal("Cannot load the routes: ", err)
+		}
+	} else {
+		routes.BindRoutes(server)
+	}
+	if ASSETS_FROM_DISK {
+		server.SetupStaticFileServer("./"+STATIC_FOLDER, "resources")
+	} else {
+		staticFS, err := fs.Sub(assets, STATIC_FOLDER)
+		if err != nil {
+			log.Fatal("Invalid static folder: ", err)
+		}
+		server.SetupStaticFS(staticFS, "resources")
+		templatesFS, err := fs.Sub(assets, "templates")
+		if err != nil {
+			log.Fatal("Invalid templates folder: ", err)
+		}
+		render.UseTemplateFS(templatesFS)
+	}
+
+	render.AddFunction("urlFor", server.URLFor)
 	tmplCache, err := render.CreateTemplateCache()
 	if err != nil {
 		log.Fatal("Cannot create a template cache")
@@ -28,16 +72,12 @@ func main() {
 	app := config.NewAppConfig(tmplCache, false)
 	render.NewTemplates(app)
 
-	server := server.NewServer(PORT)
-	routes.BindRoutes(server)
-	server.SetupStaticFileServer("./"+STATIC_FOLDER, "resources")
-
 	if err := server.SetDBConfig(DB_MANAGEMENT_SYSTEM, DB_URL); err != nil {
 		log.Fatal("The database cannot be configurated")
 	}
 
 	if err := server.Listen(); err != nil {
-		log.Fatal("Server cannot be started")
+		log.Fatal("Server stopped with errors: ", err)
 	}
 
 }
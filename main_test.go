@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/internal/config"
+	"github.com/MetalbolicX/vanilla-go-webserver/internal/routes"
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/render"
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/server"
+)
+
+// The TestEmbeddedStaticFiles test checks that the
+// embedded static files are served like the ones of the
+// static folder.
+func TestEmbeddedStaticFiles(t *testing.T) {
+	staticFS, err := fs.Sub(assets, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded := server.NewServer("127.0.0.1:0")
+	embedded.SetupStaticFS(staticFS, "resources")
+	disk := server.NewServer("127.0.0.1:0")
+	disk.SetupStaticFileServer("static", "resources")
+
+	files := 0
+	err = filepath.WalkDir("static", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".br") {
+			return err
+		}
+		files++
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		target := "/resources/" + filepath.ToSlash(strings.TrimPrefix(path, "static"+string(filepath.Separator)))
+		for name, s := range map[string]*server.Server{"embedded": embedded, "disk": disk} {
+			recorder := httptest.NewRecorder()
+			s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+			if recorder.Code != http.StatusOK || !bytes.Equal(recorder.Body.Bytes(), content) {
+				t.Errorf("the %s file %s answered %d with %d bytes, want the %d bytes of %s",
+					name, target, recorder.Code, recorder.Body.Len(), len(content), path)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType == "" {
+				t.Errorf("the %s file %s has no Content-Type", name, target)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files == 0 {
+		t.Error("the static folder has no files")
+	}
+}
+
+// The TestEmbeddedTemplates test checks that the embedded
+// templates are the pages of the templates folder and that
+// they render with the routes of the server.
+func TestEmbeddedTemplates(t *testing.T) {
+	templatesFS, err := fs.Sub(assets, "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.NewServer("127.0.0.1:0")
+	routes.BindRoutes(s)
+	staticFS, err := fs.Sub(assets, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetupStaticFS(staticFS, "resources")
+	render.AddFunction("urlFor", s.URLFor)
+	render.UseTemplateFS(templatesFS)
+	defer render.UseTemplateFS(nil)
+	cache, err := render.CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := filepath.Glob(filepath.Join("templates", "*-page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache) != len(pages) {
+		t.Errorf("the embedded templates have %d pages, the folder has %d", len(cache), len(pages))
+	}
+	for _, page := range pages {
+		if cache[filepath.Base(page)] == nil {
+			t.Errorf("the page %s is not embedded", page)
+		}
+	}
+
+	render.NewTemplates(config.NewAppConfig(cache, true))
+	recorder := httptest.NewRecorder()
+	if err := render.RenderTemplate(recorder, "home-page.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "/resources/css/styles.css") {
+		t.Errorf("the home page does not link the embedded styles:\n%s", body)
+	}
+}
@@ -2,10 +2,12 @@ package render
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
 	"net/http"
+	"os"
 	"path/filepath"
 
 	"github.com/MetalbolicX/vanilla-go-webserver/internal/config"
@@ -17,75 +19,119 @@ var functions = template.FuncMap{}
 
 var app *config.AppConfig
 
+// templateFS is the file system of the templates, nil to
+// read them from the templates folder of the working
+// directory.
+var templateFS fs.FS
+
 // NewTemplates set the config for the temaplate package
 func NewTemplates(a *config.AppConfig) {
 	app = a
 }
 
+// AddFunction registers fn under name in the functions
+// available to the templates, e.g. the server URLFor as
+// "urlFor". The templates which use a function fail to
+// parse if it is missing, so it must be called before
+// CreateTemplateCache.
+func AddFunction(name string, fn any) {
+	functions[name] = fn
+}
+
+// UseTemplateFS makes CreateTemplateCache parse the
+// templates of fsys instead of the templates folder of the
+// working directory, e.g. the templates embedded in the
+// binary with an embed.FS, so the server does not depend
+// on the directory where it starts. The pages and layouts
+// must be at the root of fsys (use fs.Sub for a folder).
+// A nil fsys reads the folder again.
+func UseTemplateFS(fsys fs.FS) {
+	templateFS = fsys
+}
+
+// ErrTemplateNotFound is returned when the requested
+// template is not in the template cache.
+var ErrTemplateNotFound = errors.New("template not found")
+
 // RenderTemplate the requested template from the template
 // cache, renders it using the provided data and sends
-// the output to the user's browser. It handles potential
-// errors during template execution and writing the output.
-func RenderTemplate(w http.ResponseWriter, tmplFileName string, tmplData *types.TemplateData) {
+// the output to the user's browser with the status 200 OK.
+// It returns the errors of the template execution and of
+// writing the output.
+func RenderTemplate(w http.ResponseWriter, tmplFileName string, tmplData *types.TemplateData) error {
+	return RenderTemplateWithStatus(w, http.StatusOK, tmplFileName, tmplData)
+}
+
+// RenderTemplateWithStatus works like RenderTemplate, but
+// sends the output with the given HTTP status code, e.g.
+// for error pages. The template is executed in a buffer
+// before anything is written, so if it returns an error
+// other than a write error, the response is untouched and
+// the caller can still answer in another way.
+func RenderTemplateWithStatus(w http.ResponseWriter, status int, tmplFileName string, tmplData *types.TemplateData) error {
+	if app == nil {
+		return errors.New("the templates are not configured, call NewTemplates")
+	}
 	// Get the template cache from the app config
 	var templateCache map[string]*template.Template
 	if app.GetIsUsingCache() {
 		templateCache = app.GetTemplateCache()
 	} else {
-		templateCache, _ = CreateTemplateCache()
+		var err error
+		templateCache, err = CreateTemplateCache()
+		if err != nil {
+			return err
+		}
 	}
 	// Get the requested template from cache
 	tmpl, templateExists := templateCache[tmplFileName]
 	if !templateExists {
-		log.Fatal("Could not get template from cache")
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, tmplFileName)
 	}
 	bufferTemplate := new(bytes.Buffer)
-	err := tmpl.Execute(bufferTemplate, tmplData)
-	if err != nil {
-		log.Println(err)
+	if err := tmpl.Execute(bufferTemplate, tmplData); err != nil {
+		return err
 	}
 	// Render the template
-	_, err = bufferTemplate.WriteTo(w)
-	if err != nil {
-		fmt.Println("Error writing template to browser", err)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := bufferTemplate.WriteTo(w); err != nil {
+		return fmt.Errorf("writing template to browser: %w", err)
 	}
+	return nil
 }
 
 // CreatetemplateCache is responsible for creating and
 // populating a cache of parsed templates. It retrieves
-// all files with the extension *.page.tmpl from the
-// ./templates directory and parses them using the
-// Go html/template package.
+// all files named *-page.html from the ./templates
+// directory, or from the file system of UseTemplateFS,
+// and parses them using the Go html/template package.
 func CreateTemplateCache() (map[string]*template.Template, error) {
 	templateCache := make(map[string]*template.Template)
-	rootPath := utils.GetRootDir()
-	// Get all files named *.page.tmpl from ./templates
-	pages, err := filepath.Glob(filepath.Join(rootPath, "templates", "*-page.html"))
+	fsys := templateFS
+	if fsys == nil {
+		fsys = os.DirFS(filepath.Join(utils.GetRootDir(), "templates"))
+	}
+	// Get all files named *-page.html from ./templates
+	pages, err := fs.Glob(fsys, "*-page.html")
+	if err != nil {
+		return templateCache, err
+	}
+	// Find layout templates (*-layout.html) in the ./templates directory
+	layouts, err := fs.Glob(fsys, "*-layout.html")
 	if err != nil {
 		return templateCache, err
 	}
-	// Range through all files ended with *.page.tmpl
+	// Range through all files ended with *-page.html
 	for _, page := range pages {
-		name := filepath.Base(page)
-		// Parse the page template file
-		templateSet, err := template.New(name).Funcs(functions).ParseFiles(page)
+		// Parse the page template file and the layouts
+		// associated with it
+		templateSet, err := template.New(page).Funcs(functions).ParseFS(fsys, append([]string{page}, layouts...)...)
 		if err != nil {
 			return templateCache, err
 		}
-		// Find layout templates (*.layout.tmpl) in the ./templates directory
-		matches, err := filepath.Glob(filepath.Join(rootPath, "templates", "*-layout.html"))
-		if err != nil {
-			return templateCache, err
-		}
-		// If layout templates are found, parse them and associate them with the page template
-		if len(matches) > 0 {
-			templateSet, err = templateSet.ParseGlob(filepath.Join(rootPath, "templates", "*-layout.html"))
-			if err != nil {
-				return templateCache, err
-			}
-		}
 		// Store the template set in the cache map with the template name as the key
-		templateCache[name] = templateSet
+		templateCache[page] = templateSet
 	}
 	return templateCache, nil
 }
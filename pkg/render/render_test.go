@@ -0,0 +1,108 @@
+package render
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/internal/config"
+)
+
+// The layout is the base layout of the test templates.
+const layout = `{{define "base"}}<main>{{block "content" .}}{{end}}</main>{{end}}`
+
+func TestCreateTemplateCache(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "templates"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"disk-page.html":   `{{template "base" .}}{{define "content"}}disk{{end}}`,
+		"base-layout.html": layout,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "templates", name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	defer UseTemplateFS(nil)
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		page string
+		body string
+	}{
+		// Without a file system the templates folder of the
+		// working directory is read.
+		{"disk", nil, "disk-page.html", "<main>disk</main>"},
+		{"embedded", fstest.MapFS{
+			"embedded-page.html": {Data: []byte(`{{template "base" .}}{{define "content"}}embedded{{end}}`)},
+			"base-layout.html":   {Data: []byte(layout)},
+		}, "embedded-page.html", "<main>embedded</main>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.fsys == nil {
+				UseTemplateFS(nil)
+			} else {
+				UseTemplateFS(test.fsys)
+			}
+			cache, err := CreateTemplateCache()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cache) != 1 || cache[test.page] == nil {
+				t.Fatalf("the template cache has %v, want only %s", cache, test.page)
+			}
+			NewTemplates(config.NewAppConfig(cache, true))
+			recorder := httptest.NewRecorder()
+			if err := RenderTemplateWithStatus(recorder, http.StatusTeapot, test.page, nil); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code != http.StatusTeapot || recorder.Body.String() != test.body {
+				t.Errorf("the page answered %d %q, want %d %q", recorder.Code, recorder.Body.String(), http.StatusTeapot, test.body)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+				t.Errorf("the Content-Type is %q", contentType)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	defer UseTemplateFS(nil)
+	UseTemplateFS(fstest.MapFS{
+		"broken-page.html": {Data: []byte(`{{template "base" .}}{{define "content"}}{{.Missing.Field}}{{end}}`)},
+		"base-layout.html": {Data: []byte(layout)},
+	})
+	cache, err := CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewTemplates(config.NewAppConfig(cache, true))
+
+	recorder := httptest.NewRecorder()
+	if err := RenderTemplate(recorder, "missing-page.html", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("rendering a missing page returned %v, want ErrTemplateNotFound", err)
+	}
+	if err := RenderTemplate(recorder, "broken-page.html", nil); err == nil {
+		t.Error("rendering a broken page returned no error")
+	}
+	// Nothing is written when the rendering fails, so the
+	// caller can still answer.
+	if recorder.Body.Len() != 0 || recorder.Header().Get("Content-Type") != "" {
+		t.Errorf("the failed renderings wrote %q", recorder.Body.String())
+	}
+
+	UseTemplateFS(fstest.MapFS{
+		"invalid-page.html": {Data: []byte(`{{template "base" .}`)},
+	})
+	if _, err := CreateTemplateCache(); err == nil {
+		t.Error("CreateTemplateCache with an invalid template returned no error")
+	}
+}
@@ -12,6 +12,7 @@ import (
 // , retrieving data, updating data, or deleting data.
 type Repository interface {
 	Close() error
+	Ping(ctx context.Context) error
 	ExecuteCommand(ctx context.Context, query string, args ...any) ([]map[string]any, error)
 	Post(ctx context.Context, query string, args ...any) error
 	Get(ctx context.Context, query string, args ...any) ([]map[string]any, error)
@@ -36,6 +37,14 @@ func Close() error {
 	return implementation.Close()
 }
 
+// Ping is a function that delegates the call to the Ping
+// method of the underlying repository implementation.
+// It checks that the database can be reached, e.g. for
+// the readiness check of the server.
+func Ping(ctx context.Context) error {
+	return implementation.Ping(ctx)
+}
+
 // ExecuteCommand is a function that delegates the call
 // to the ExecuteCommand method of the underlying repository
 // implementation. It executes a database command/query
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/render"
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// internalErrorKey is the context key of the handler which
+// answers the internal errors of the server serving the
+// request.
+type internalErrorKey struct{}
+
+// The problem struct is a problem document as defined in
+// RFC 9457, the JSON error answered to the API clients.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Instance string `json:"instance"`
+}
+
+// WithNotFoundHandler sets the handler which answers the
+// requests whose path does not match any route.
+func WithNotFoundHandler(handlerLogic http.HandlerFunc) Option {
+	return func(s *Server) {
+		s.router.notFound = handlerLogic
+	}
+}
+
+// WithMethodNotAllowedHandler sets the handler which
+// answers the requests whose path matches a route, but
+// not for the request method. The Allow header is already
+// set when it is called.
+func WithMethodNotAllowedHandler(handlerLogic http.HandlerFunc) Option {
+	return func(s *Server) {
+		s.router.methodNotAllowed = handlerLogic
+	}
+}
+
+// WithInternalErrorHandler sets the handler which answers
+// the requests that fail with an internal error, see
+// InternalError.
+func WithInternalErrorHandler(handlerLogic http.HandlerFunc) Option {
+	return func(s *Server) {
+		s.internalError = handlerLogic
+	}
+}
+
+// InternalError logs err and answers the request with the
+// internal error handler of the server, 500 Internal
+// Server Error by default. The error is not shown to the
+// client. The handlers call it when they cannot complete
+// the request, e.g. when a template fails to render.
+func InternalError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	handlerLogic, ok := r.Context().Value(internalErrorKey{}).(http.HandlerFunc)
+	if !ok {
+		handlerLogic = ErrorHandler(http.StatusInternalServerError)
+	}
+	handlerLogic(w, r)
+}
+
+// The withInternalError middleware stores the internal
+// error handler in the request context, so InternalError
+// can find it.
+func (s *Server) withInternalError(nextHandler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), internalErrorKey{}, s.internalError)
+		nextHandler(w, r.WithContext(ctx))
+	}
+}
+
+// ErrorHandler returns the default handler for the error
+// status. It chooses the format with the Accept header of
+// the request: the API clients, which prefer JSON or do not
+// express a preference, get a problem document (RFC 9457)
+// with the application/problem+json type. The browsers,
+// which prefer HTML, get the template <status>-page.html
+// (e.g., 404-page.html) or, if it does not exist, the
+// generic error-page.html. The templates receive the status
+// in IntMap["status"] and its text in Error. If no template
+// can be rendered, a plain text answer is sent.
+func ErrorHandler(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title := http.StatusText(status)
+		if prefersHTML(r.Header.Get("Accept")) {
+			data := &types.TemplateData{
+				IntMap: map[string]int{"status": status},
+				Error:  title,
+			}
+			for _, tmplFileName := range []string{strconv.Itoa(status) + "-page.html", "error-page.html"} {
+				err := render.RenderTemplateWithStatus(w, status, tmplFileName, data)
+				if err == nil {
+					return
+				}
+				if !errors.Is(err, render.ErrTemplateNotFound) {
+					log.Printf("rendering the error page %s: %v", tmplFileName, err)
+					break
+				}
+			}
+			http.Error(w, title, status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(problem{
+			Type:     "about:blank",
+			Title:    title,
+			Status:   status,
+			Instance: r.URL.Path,
+		})
+	}
+}
+
+// The prefersHTML function reports whether the Accept
+// header gives HTML a higher quality than JSON. A tie, like
+// */* or an empty header, goes to JSON, because the
+// browsers always ask for text/html explicitly.
+func prefersHTML(accept string) bool {
+	html := acceptQuality(accept, "text/html")
+	json := acceptQuality(accept, "application/json")
+	if problemJSON := acceptQuality(accept, "application/problem+json"); problemJSON > json {
+		json = problemJSON
+	}
+	return html > json
+}
+
+// The acceptQuality function returns the quality (the q
+// parameter) given by the Accept header to the media type,
+// taken from the most specific range which matches it.
+// An empty header accepts everything with quality 1.
+func acceptQuality(accept, mediaType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		rangeType, params, _ := strings.Cut(mediaRange, ";")
+		rangeType = strings.ToLower(strings.TrimSpace(rangeType))
+		rangeSpecificity := -1
+		switch rangeType {
+		case mediaType:
+			rangeSpecificity = 2
+		case mainType + "/*":
+			rangeSpecificity = 1
+		case "*/*":
+			rangeSpecificity = 0
+		}
+		if rangeSpecificity <= specificity {
+			continue
+		}
+		specificity = rangeSpecificity
+		quality = 1
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					parsed = 0
+				}
+				quality = parsed
+			}
+		}
+	}
+	return quality
+}
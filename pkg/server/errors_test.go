@@ -0,0 +1,51 @@
+package server
+
+import "testing"
+
+func TestAcceptQuality(t *testing.T) {
+	tests := []struct {
+		accept    string
+		mediaType string
+		want      float64
+	}{
+		{"", "text/html", 1},
+		{"   ", "application/json", 1},
+		{"text/html", "text/html", 1},
+		{"text/html", "application/json", 0},
+		{"text/html;q=0.8", "text/html", 0.8},
+		{"TEXT/HTML; q=0.5", "text/html", 0.5},
+		{"text/*;q=0.3, text/html;q=0.7", "text/html", 0.7},
+		{"text/html;q=0.7, text/*;q=0.3", "text/html", 0.7},
+		{"text/*;q=0.3", "text/html", 0.3},
+		{"*/*;q=0.1", "application/json", 0.1},
+		{"*/*;q=0.1, application/*;q=0.4", "application/json", 0.4},
+		{"text/html;level=1;q=0.2", "text/html", 0.2},
+		{"text/html;q=abc", "text/html", 0},
+		{"application/json;q=0", "application/json", 0},
+	}
+	for _, test := range tests {
+		if got := acceptQuality(test.accept, test.mediaType); got != test.want {
+			t.Errorf("acceptQuality(%q, %q) = %v, want %v", test.accept, test.mediaType, got, test.want)
+		}
+	}
+}
+
+func TestPrefersHTML(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", true},
+		{"text/html;q=0.5, application/json", false},
+		{"text/html, application/problem+json;q=0.9", true},
+		{"text/html;q=0.9, application/problem+json", false},
+	}
+	for _, test := range tests {
+		if got := prefersHTML(test.accept); got != test.want {
+			t.Errorf("prefersHTML(%q) = %v, want %v", test.accept, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// The Group represents a set of routes which share a URL
+// path prefix and a chain of middlewares. It is created
+// with Server.Group or Group.Group, so the groups can be
+// nested: a nested group inherits the prefix and the
+// middlewares of its parent and adds its own ones. A group
+// keeps track of its routes and the ones of its nested
+// groups, so they can be removed together. A group
+// created with Server.Host only matches the requests for
+// its host pattern, and so do its nested groups. The
+// routes of a batch group (see Batch) are published
+// together.
+type Group struct {
+	server      *Server
+	parent      *Group
+	batch       *routeBatch
+	host        string
+	prefix      string
+	middlewares []types.Middleware
+	mu          sync.Mutex
+	routes      []*Route
+}
+
+// The Group method of the Server creates a group of routes
+// whose patterns start with prefix (e.g., /api/v1) and
+// whose handlers are wrapped by the given middlewares.
+func (s *Server) Group(prefix string, middlewares ...types.Middleware) *Group {
+	return &Group{
+		server:      s,
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		middlewares: middlewares,
+	}
+}
+
+// The Group method creates a nested group. Its prefix is
+// appended to the prefix of g and its middlewares run
+// after the middlewares of g.
+func (g *Group) Group(prefix string, middlewares ...types.Middleware) *Group {
+	inherited := make([]types.Middleware, 0, len(g.middlewares)+len(middlewares))
+	inherited = append(inherited, g.middlewares...)
+	inherited = append(inherited, middlewares...)
+	return &Group{
+		server:      g.server,
+		parent:      g,
+		batch:       g.batch,
+		host:        g.host,
+		prefix:      g.prefix + strings.TrimSuffix(prefix, "/"),
+		middlewares: inherited,
+	}
+}
+
+// The Handle method defines a routing rule in the group.
+// The group prefix is prepended to the path, so with the
+// prefix /api/v1 the path /customer/{id:int} is registered
+// as /api/v1/customer/{id:int} and an empty path as
+// /api/v1. The handler function is wrapped by the group
+// middlewares in the order they were given: the first
+// middleware is the first to receive the request. It
+// returns the route, which can be named like the routes
+// registered with Server.Handle.
+func (g *Group) Handle(method, path string, handlerLogic http.HandlerFunc) *Route {
+	rte := g.server.handle(g.batch, g.host, method, g.prefix+path, handlerLogic, g.middlewares)
+	g.track(rte)
+	return rte
+}
+
+// The Remove method deletes all the routes registered
+// through the group and its nested groups in a single
+// atomic change of the routing table. The group can be
+// used again to register new routes. It returns how many
+// routes were removed.
+func (g *Group) Remove() int {
+	g.mu.Lock()
+	routes := g.routes
+	g.routes = nil
+	g.mu.Unlock()
+	return g.server.router.removeRoutes(g.batch, routes...)
+}
+
+// The Batch method calls register with a group like g
+// whose changes of the routing table are published in a
+// single atomic swap when register returns, instead of
+// one swap per route. So the requests see all the routes
+// of the batch or none of them, and registering many
+// routes does not copy the table many times. The routes,
+// names and removals made through the batch group, its
+// nested groups and its routes are part of the batch.
+// Batch panics, and publishes nothing, if register panics
+// or a change cannot be applied again to the routing
+// table because it was changed by a concurrent
+// registration.
+//
+//	s.Batch(func(batch *server.Group) {
+//		api := batch.Group("/api/v1")
+//		api.Handle(http.MethodGet, "/customer/{id:int}", getCustomer).Name("customer")
+//		api.Handle(http.MethodPut, "/customer/{id:int}", updateCustomer)
+//	})
+func (g *Group) Batch(register func(batch *Group)) {
+	batch := g.server.router.newBatch()
+	defer func() { batch.done = true }()
+	register(&Group{
+		server:      g.server,
+		parent:      g,
+		batch:       batch,
+		host:        g.host,
+		prefix:      g.prefix,
+		middlewares: g.middlewares,
+	})
+	if err := g.server.router.commit(batch); err != nil {
+		panic(err)
+	}
+}
+
+// The Batch method of the Server registers routes in a
+// batch, see Group.Batch.
+func (s *Server) Batch(register func(batch *Group)) {
+	s.Group("").Batch(register)
+}
+
+// The track method records the route in the group and in
+// all its parent groups.
+func (g *Group) track(rte *Route) {
+	for group := g; group != nil; group = group.parent {
+		group.mu.Lock()
+		group.routes = append(group.routes, rte)
+		group.mu.Unlock()
+	}
+}
+
+// The chainMiddlewares function wraps the handler logic
+// with the middlewares, so that middlewares[0] is the
+// outermost one and runs first, and the last middleware
+// calls the handler logic.
+func chainMiddlewares(handlerLogic http.HandlerFunc, middlewares []types.Middleware) http.HandlerFunc {
+	for index := len(middlewares) - 1; index >= 0; index-- {
+		handlerLogic = middlewares[index](handlerLogic)
+	}
+	return handlerLogic
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// The traceMiddleware function returns a middleware which
+// adds its name to the X-Trace header, to tell in which
+// order the middlewares ran.
+func traceMiddleware(name string) types.Middleware {
+	return func(nextHandler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			nextHandler(w, r)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	api := s.Group("/api/", traceMiddleware("api"))
+	v1 := api.Group("/v1", traceMiddleware("v1"), traceMiddleware("v1b"))
+	api.Handle(http.MethodGet, "", namedHandler("api root"))
+	v1.Handle(http.MethodGet, "/customer/{id:int}", namedHandler("customer"))
+	s.Handle(http.MethodGet, "/customer/{id:int}", namedHandler("plain"))
+
+	tests := []struct {
+		path  string
+		body  string
+		trace string
+	}{
+		{"/api", "api root", "api"},
+		// The middlewares of the outer group run first.
+		{"/api/v1/customer/1", "customer", "api,v1,v1b"},
+		{"/customer/1", "plain", ""},
+	}
+	for _, test := range tests {
+		w := serve(s.router, http.MethodGet, test.path)
+		if w.Body.String() != test.body {
+			t.Errorf("GET %s answered %q, want %q", test.path, w.Body.String(), test.body)
+		}
+		if trace := strings.Join(w.Header().Values("X-Trace"), ","); trace != test.trace {
+			t.Errorf("GET %s ran the middlewares %q, want %q", test.path, trace, test.trace)
+		}
+	}
+}
+
+func TestGroupRemove(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	reports := s.Group("/reports")
+	reports.Handle(http.MethodGet, "/sales", noopHandler)
+	reports.Group("/daily").Handle(http.MethodGet, "/sales", noopHandler)
+	s.Handle(http.MethodGet, "/reports", noopHandler)
+
+	if removed := reports.Remove(); removed != 2 {
+		t.Errorf("Remove removed %d routes, want the 2 of the group and its nested group", removed)
+	}
+	for path, status := range map[string]int{
+		"/reports/sales":       http.StatusNotFound,
+		"/reports/daily/sales": http.StatusNotFound,
+		"/reports":             http.StatusOK,
+	} {
+		if w := serve(s.router, http.MethodGet, path); w.Code != status {
+			t.Errorf("GET %s answered %d after Remove, want %d", path, w.Code, status)
+		}
+	}
+	// The group can be used again.
+	reports.Handle(http.MethodGet, "/sales", noopHandler)
+	if w := serve(s.router, http.MethodGet, "/reports/sales"); w.Code != http.StatusOK {
+		t.Errorf("GET /reports/sales answered %d after registering it again, want 200", w.Code)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	before := s.router.table.Load()
+	var removed *Route
+	s.Batch(func(batch *Group) {
+		api := batch.Group("/api")
+		api.Handle(http.MethodGet, "/customer/{id:int}", namedHandler("customer")).Name("customer")
+		removed = api.Handle(http.MethodGet, "/old", noopHandler)
+		batch.Mount("/admin", namedHandler("admin"))
+		if s.router.table.Load() != before {
+			t.Error("the batch published a change before it ended")
+		}
+		if !removed.Remove() {
+			t.Error("the route registered in the batch was not removed")
+		}
+	})
+
+	if got, err := s.URLFor("customer", "id", 1); err != nil || got != "/api/customer/1" {
+		t.Errorf(`URLFor("customer", "id", 1) = (%q, %v), want /api/customer/1`, got, err)
+	}
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{"/api/customer/1", http.StatusOK},
+		{"/admin/users", http.StatusOK},
+		{"/api/old", http.StatusNotFound},
+	} {
+		if w := serve(s.router, http.MethodGet, test.path); w.Code != test.status {
+			t.Errorf("GET %s answered %d, want %d", test.path, w.Code, test.status)
+		}
+	}
+	// The routes of an ended batch are changed at once.
+	if removed.Remove() {
+		t.Error("a route removed in the batch was removed again")
+	}
+}
+
+func TestBatchReplay(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	s.Batch(func(batch *Group) {
+		batch.Handle(http.MethodGet, "/customer/{id:int}", noopHandler).Name("customer")
+		// A concurrent registration changes the table, so the
+		// batch is applied again on top of it.
+		s.Handle(http.MethodGet, "/home", noopHandler)
+	})
+	for _, path := range []string{"/customer/1", "/home"} {
+		if w := serve(s.router, http.MethodGet, path); w.Code != http.StatusOK {
+			t.Errorf("GET %s answered %d, want 200", path, w.Code)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("a batch which conflicts with a concurrent registration did not panic")
+		}
+		if w := serve(s.router, http.MethodGet, "/orders"); w.Code != http.StatusNotFound {
+			t.Errorf("the failed batch published its routes, GET /orders answered %d", w.Code)
+		}
+	}()
+	s.Batch(func(batch *Group) {
+		batch.Handle(http.MethodGet, "/orders", noopHandler)
+		batch.Handle(http.MethodGet, "/invoices", noopHandler)
+		s.Handle(http.MethodGet, "/invoices", noopHandler)
+	})
+}
+
+func TestBatchPanic(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	defer func() {
+		if recover() == nil {
+			t.Error("a batch with a conflicting route did not panic")
+		}
+		if w := serve(s.router, http.MethodGet, "/customer/1"); w.Code != http.StatusNotFound {
+			t.Errorf("the failed batch published its routes, GET /customer/1 answered %d", w.Code)
+		}
+	}()
+	s.Batch(func(batch *Group) {
+		batch.Handle(http.MethodGet, "/customer/{id:int}", noopHandler)
+		batch.Handle(http.MethodGet, "/customer/{number:int}", noopHandler)
+	})
+}
+
+func BenchmarkRegisterBatch1000(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		s := NewServer("127.0.0.1:0")
+		s.Batch(func(batch *Group) {
+			for index := range 1000 {
+				batch.Handle(http.MethodGet, fmt.Sprintf("/api/v1/resource%d/{id:int}", index), noopHandler)
+			}
+		})
+	}
+}
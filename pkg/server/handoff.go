@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The environment variables which describe the sockets
+// passed by a running server to the process which
+// replaces it (see handoff). handoffFDsEnv lists the
+// names of the listeners, with the file descriptors 3, 4,
+// and so on, and handoffReadyEnv has the descriptor of
+// the pipe where the new process reports it is ready.
+const (
+	handoffFDsEnv   = "SERVER_HANDOFF_FDS"
+	handoffReadyEnv = "SERVER_HANDOFF_READY_FD"
+)
+
+// The names of the listeners passed in a handoff.
+const (
+	serverListenerName   = "server"
+	redirectListenerName = "redirect"
+)
+
+// inherited stores the listeners passed by the previous
+// process, by name, until the server uses them.
+var inherited = inheritedListeners()
+
+// The inheritedListeners function returns the listeners
+// passed by the previous process in a handoff, or an
+// empty map if the process was started normally. The
+// variables are removed, so the child processes do not
+// use the sockets too.
+func inheritedListeners() map[string]net.Listener {
+	listeners := make(map[string]net.Listener)
+	names := os.Getenv(handoffFDsEnv)
+	if names == "" {
+		return listeners
+	}
+	os.Unsetenv(handoffFDsEnv)
+	for index, name := range strings.Split(names, ",") {
+		fd := listenFDsStart + index
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+		listeners[name] = listener
+	}
+	return listeners
+}
+
+// The takeInherited function returns the inherited
+// listener called name, if any, and forgets it, so it is
+// used once.
+func takeInherited(name string) net.Listener {
+	listener := inherited[name]
+	delete(inherited, name)
+	return listener
+}
+
+// The notifyReady function tells the previous process,
+// when there is one, that this process is serving, so it
+// can shut down.
+func notifyReady() error {
+	value := os.Getenv(handoffReadyEnv)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(handoffReadyEnv)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", handoffReadyEnv, err)
+	}
+	pipe := os.NewFile(uintptr(fd), "handoff-ready")
+	defer pipe.Close()
+	_, err = pipe.Write([]byte("ready"))
+	return err
+}
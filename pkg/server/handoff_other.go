@@ -0,0 +1,18 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// handoffSignals is empty, because the systems which are
+// not Unix have no signal to ask for a restart.
+var handoffSignals []os.Signal
+
+// The handoff method is only supported on Unix, where the
+// sockets can be passed to a new process as files.
+func (s *Server) handoff() error {
+	return errors.New("the listener handoff is only supported on Unix")
+}
@@ -0,0 +1,106 @@
+//go:build unix
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// handoffSignals are the signals which make the server
+// start a new process of its executable and hand it the
+// listening sockets.
+var handoffSignals = []os.Signal{syscall.SIGUSR2}
+
+// The handoff method starts the executable of the server
+// again, e.g. a new version just deployed, passing it the
+// listening sockets, and waits until it reports it is
+// serving. Meanwhile both processes accept connections on
+// the same sockets, so no connection is refused. The
+// caller then shuts the old server down. If the new
+// process does not get ready within the shutdown timeout
+// it is killed and the old server keeps serving.
+func (s *Server) handoff() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	names := []string{serverListenerName}
+	listeners := []net.Listener{s.listener}
+	if s.redirectListener != nil {
+		names = append(names, redirectListenerName)
+		listeners = append(listeners, s.redirectListener)
+	}
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	for _, listener := range listeners {
+		filer, ok := listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("the listener %T cannot be passed to another process", listener)
+		}
+		file, err := filer.File()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		files = append(files, file)
+	}
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+	files = append(files, readyWriter)
+
+	env := make([]string, 0)
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, handoffFDsEnv+"=") && !strings.HasPrefix(variable, handoffReadyEnv+"=") {
+			env = append(env, variable)
+		}
+	}
+	env = append(env,
+		handoffFDsEnv+"="+strings.Join(names, ","),
+		handoffReadyEnv+"="+strconv.Itoa(len(files)-1),
+	)
+	process, err := os.StartProcess(executable, os.Args, &os.ProcAttr{Env: env, Files: files})
+	readyWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		message := make([]byte, len("ready"))
+		_, err := io.ReadFull(readyReader, message)
+		ready <- err
+	}()
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+	case <-timer.C:
+		err = errors.New("timeout")
+	}
+	if err != nil {
+		// Wait reaps the killed process, so it is not left
+		// as a zombie.
+		process.Kill()
+		process.Wait()
+		return fmt.Errorf("the new process did not get ready: %w", err)
+	}
+	process.Release()
+
+	// The new process serves on the same socket file, so
+	// it must not be removed when this listener closes.
+	if unixListener, ok := s.listener.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+	return nil
+}
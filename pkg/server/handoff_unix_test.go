@@ -0,0 +1,110 @@
+//go:build unix
+
+package server
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The TestHandoff test hands the listening socket to a new
+// process of the test binary, which reports it is ready
+// and answers a connection on the inherited socket.
+func TestHandoff(t *testing.T) {
+	switch os.Getenv("TEST_HANDOFF_CHILD") {
+	case "serve":
+		handoffChild()
+		return
+	case "hang":
+		time.Sleep(time.Minute)
+		return
+	}
+
+	tests := []struct {
+		name    string
+		child   string
+		timeout time.Duration
+		failure bool
+	}{
+		{"ready", "serve", 10 * time.Second, false},
+		{"not ready", "hang", 200 * time.Millisecond, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The new process runs the executable with the
+			// arguments of this one, so it only runs this test.
+			args := os.Args
+			os.Args = []string{args[0], "-test.run=^TestHandoff$"}
+			defer func() { os.Args = args }()
+			t.Setenv("TEST_HANDOFF_CHILD", test.child)
+
+			s := NewServer("127.0.0.1:0")
+			s.shutdownTimeout = test.timeout
+			listener, err := net.Listen("tcp", s.port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.listener = listener
+			err = s.handoff()
+			if (err != nil) != test.failure {
+				listener.Close()
+				t.Fatalf("handoff returned %v", err)
+			}
+			// Only the new process keeps the socket open.
+			listener.Close()
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if test.failure {
+				if err == nil {
+					conn.Close()
+					t.Error("the killed process still listens on the socket")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+			answer, _ := bufio.NewReader(conn).ReadString('\n')
+			if answer != "ok\n" {
+				t.Errorf("the new process answered %q", answer)
+			}
+		})
+	}
+}
+
+// The handoffChild function is the new process of
+// TestHandoff. It reports the problems on the connection,
+// since nobody waits for its exit status.
+func handoffChild() {
+	listener := takeInherited(serverListenerName)
+	if listener == nil {
+		return
+	}
+	defer listener.Close()
+	problems := make([]string, 0)
+	if takeInherited(serverListenerName) != nil {
+		problems = append(problems, "the listener was inherited twice")
+	}
+	if err := notifyReady(); err != nil {
+		problems = append(problems, "notifyReady: "+err.Error())
+	}
+	for _, key := range []string{handoffFDsEnv, handoffReadyEnv} {
+		if value, exists := os.LookupEnv(key); exists {
+			problems = append(problems, key+"="+value+" was not removed")
+		}
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if len(problems) == 0 {
+		problems = append(problems, "ok")
+	}
+	conn.Write([]byte(strings.Join(problems, "; ") + "\n"))
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The default health settings of the server.
+const (
+	defaultLivenessPath       = "/healthz"
+	defaultReadinessPath      = "/readyz"
+	defaultHealthCheckTimeout = 2 * time.Second
+)
+
+// The HealthChecker checks whether a dependency of the
+// server, e.g. the database or another service, can be
+// used. It returns an error when it cannot, and it must
+// give up when ctx is done.
+type HealthChecker func(ctx context.Context) error
+
+// The healthCheck is a checker with the name shown in the
+// readiness report.
+type healthCheck struct {
+	name    string
+	checker HealthChecker
+}
+
+// The healthReport is the JSON document of the liveness
+// and readiness endpoints.
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// The checkResult is the result of a checker in the
+// readiness report.
+type checkResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// WithHealthPaths sets the paths of the liveness and the
+// readiness endpoints, /healthz and /readyz by default.
+// An empty path disables the endpoint.
+func WithHealthPaths(livenessPath, readinessPath string) Option {
+	return func(s *Server) {
+		s.livenessPath = livenessPath
+		s.readinessPath = readinessPath
+	}
+}
+
+// WithHealthCheckTimeout sets the maximum time of every
+// health checker, 2 seconds by default. A checker which
+// does not finish in time fails.
+func WithHealthCheckTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.healthCheckTimeout = timeout
+	}
+}
+
+// WithDrainDelay sets how long the server keeps serving
+// after the shutdown starts, with the readiness endpoint
+// failing, before it stops accepting connections. It gives
+// the load balancers the time to see the failing check and
+// send the new requests to other instances. The delay is
+// part of the shutdown timeout. Zero, the default, means
+// no delay.
+func WithDrainDelay(delay time.Duration) Option {
+	return func(s *Server) {
+		s.drainDelay = delay
+	}
+}
+
+// The AddHealthCheck method registers a checker which
+// must pass for the server to be ready. The name
+// identifies it in the readiness report. It must be
+// called before Listen.
+func (s *Server) AddHealthCheck(name string, checker HealthChecker) {
+	s.healthChecks = append(s.healthChecks, healthCheck{name: name, checker: checker})
+}
+
+// The withHealth middleware answers the GET and HEAD
+// requests to the liveness and readiness paths, on any
+// host, before the global middlewares, so the probes of
+// the load balancers do not fill the logs. The other
+// requests go to the next handler.
+func (s *Server) withHealth(nextHandler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			nextHandler(w, r)
+			return
+		}
+		switch {
+		case s.livenessPath != "" && r.URL.Path == s.livenessPath:
+			writeHealthReport(w, http.StatusOK, healthReport{Status: "ok"})
+		case s.readinessPath != "" && r.URL.Path == s.readinessPath:
+			s.readiness(w, r)
+		default:
+			nextHandler(w, r)
+		}
+	}
+}
+
+// The readiness method answers 200 OK when all the health
+// checkers pass and 503 Service Unavailable when one of
+// them fails or the server is shutting down. The checkers
+// run at the same time, each one with the health check
+// timeout.
+func (s *Server) readiness(w http.ResponseWriter, r *http.Request) {
+	if s.shuttingDown.Load() {
+		writeHealthReport(w, http.StatusServiceUnavailable, healthReport{Status: "shutting down"})
+		return
+	}
+	report := healthReport{Status: "ok", Checks: make(map[string]checkResult, len(s.healthChecks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range s.healthChecks {
+		wg.Add(1)
+		go func(check healthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), s.healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check.checker(ctx)
+			result := checkResult{Status: "ok", Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = "failing"
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			report.Checks[check.name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, result := range report.Checks {
+		if result.Status != "ok" {
+			report.Status = "failing"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeHealthReport(w, status, report)
+}
+
+// The writeHealthReport function sends the report as JSON.
+// The health answers must never be cached.
+func writeHealthReport(w http.ResponseWriter, status int, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// The drain method marks the server as shutting down, so
+// the readiness endpoint fails, and waits for the drain
+// delay or until ctx is done.
+func (s *Server) drain(ctx context.Context) {
+	if s.shuttingDown.Swap(true) || s.drainDelay <= 0 {
+		return
+	}
+	timer := time.NewTimer(s.drainDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The probe function sends the request to the handler of
+// the server and decodes the health report of the answer,
+// if any.
+func probe(s *Server, method, path string) (*httptest.ResponseRecorder, healthReport) {
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	var report healthReport
+	json.Unmarshal(recorder.Body.Bytes(), &report)
+	return recorder, report
+}
+
+func TestLiveness(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      []Option
+		method, path string
+		status       int
+	}{
+		{"GET", nil, http.MethodGet, "/healthz", http.StatusOK},
+		{"HEAD", nil, http.MethodHead, "/healthz", http.StatusOK},
+		{"other method", nil, http.MethodPost, "/healthz", http.StatusNotFound},
+		{"custom path", []Option{WithHealthPaths("/live", "/ready")}, http.MethodGet, "/live", http.StatusOK},
+		{"default path replaced", []Option{WithHealthPaths("/live", "/ready")}, http.MethodGet, "/healthz", http.StatusNotFound},
+		{"disabled", []Option{WithHealthPaths("", "")}, http.MethodGet, "/healthz", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer("127.0.0.1:0", test.options...)
+			// A failing checker only affects the readiness.
+			s.AddHealthCheck("database", func(ctx context.Context) error { return errors.New("down") })
+			recorder, report := probe(s, test.method, test.path)
+			if recorder.Code != test.status {
+				t.Fatalf("%s %s answered %d, want %d", test.method, test.path, recorder.Code, test.status)
+			}
+			if test.status == http.StatusOK && test.method == http.MethodGet && report.Status != "ok" {
+				t.Errorf("the liveness report is %+v", report)
+			}
+			if test.status == http.StatusOK && recorder.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("the liveness answer has Cache-Control %q, want no-store", recorder.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	passing := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		select {
+		case <-time.After(5 * time.Second):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	tests := []struct {
+		name     string
+		checkers map[string]HealthChecker
+		status   int
+		checks   map[string]checkResult
+	}{
+		{"no checkers", nil, http.StatusOK, nil},
+		{"passing", map[string]HealthChecker{"database": passing, "cache": passing}, http.StatusOK,
+			map[string]checkResult{"database": {Status: "ok"}, "cache": {Status: "ok"}}},
+		{"failing", map[string]HealthChecker{"database": passing, "cache": failing}, http.StatusServiceUnavailable,
+			map[string]checkResult{"database": {Status: "ok"}, "cache": {Status: "failing", Error: "connection refused"}}},
+		{"timeout", map[string]HealthChecker{"database": slow}, http.StatusServiceUnavailable,
+			map[string]checkResult{"database": {Status: "failing", Error: context.DeadlineExceeded.Error()}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer("127.0.0.1:0", WithHealthCheckTimeout(50*time.Millisecond))
+			for name, checker := range test.checkers {
+				s.AddHealthCheck(name, checker)
+			}
+			start := time.Now()
+			recorder, report := probe(s, http.MethodGet, "/readyz")
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("the readiness check took %s, the checkers were not stopped at the timeout", elapsed)
+			}
+			if recorder.Code != test.status {
+				t.Errorf("GET /readyz answered %d, want %d", recorder.Code, test.status)
+			}
+			if len(report.Checks) != len(test.checks) {
+				t.Fatalf("the report has the checks %+v, want %+v", report.Checks, test.checks)
+			}
+			for name, want := range test.checks {
+				got := report.Checks[name]
+				if got.Status != want.Status || got.Error != want.Error || got.Duration == "" {
+					t.Errorf("the check %s is %+v, want %+v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadinessDuringShutdown(t *testing.T) {
+	const drainDelay = 200 * time.Millisecond
+	s := NewServer("127.0.0.1:0", WithDrainDelay(drainDelay))
+	s.Handle(http.MethodGet, "/customer", noopHandler)
+	if recorder, _ := probe(s, http.MethodGet, "/readyz"); recorder.Code != http.StatusOK {
+		t.Fatalf("GET /readyz answered %d before the shutdown, want 200", recorder.Code)
+	}
+
+	start := time.Now()
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- s.Shutdown(context.Background())
+	}()
+	for !s.shuttingDown.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	recorder, report := probe(s, http.MethodGet, "/readyz")
+	if recorder.Code != http.StatusServiceUnavailable || report.Status != "shutting down" {
+		t.Errorf("GET /readyz answered %d %+v during the drain delay, want 503", recorder.Code, report)
+	}
+	// The server keeps serving the requests during the
+	// drain delay.
+	if recorder, _ := probe(s, http.MethodGet, "/customer"); recorder.Code != http.StatusOK {
+		t.Errorf("GET /customer answered %d during the drain delay, want 200", recorder.Code)
+	}
+	if recorder, _ := probe(s, http.MethodGet, "/healthz"); recorder.Code != http.StatusOK {
+		t.Errorf("GET /healthz answered %d during the drain delay, want 200", recorder.Code)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < drainDelay {
+		t.Errorf("Shutdown returned after %s, before the drain delay of %s", elapsed, drainDelay)
+	}
+}
+
+func TestDrainDelayTimeout(t *testing.T) {
+	s := NewServer("127.0.0.1:0", WithDrainDelay(time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Shutdown waited %s, the drain delay must end with the context", elapsed)
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// The hostTable holds the routing tree of a virtual host.
+// The pattern is split in labels (the parts between the
+// dots), which are static or parameters like in the URL
+// path patterns, e.g. {tenant}.example.test.
+type hostTable struct {
+	pattern string
+	labels  []segment
+	root    *node
+}
+
+// The Host method of the Server creates a group of routes
+// which only match the requests whose Host header matches
+// the pattern. The pattern can capture labels as
+// parameters, e.g. {tenant}.example.test, and their values
+// are available through GetParams together with the path
+// parameters. The routes registered with Server.Handle, or
+// in groups without host, are the default ones, used for
+// the requests whose host does not match any pattern. They
+// are used too when the host matches, but the path and
+// method do not match any route of the host, so a host
+// only needs to declare the routes which it changes. In
+// that case the host parameters are not available, and
+// the Allow header of a 405 answer lists the methods of
+// both the host and the default routes.
+func (s *Server) Host(pattern string, middlewares ...types.Middleware) *Group {
+	group := s.Group("", middlewares...)
+	group.host = pattern
+	return group
+}
+
+// The parseHostPattern function normalizes the host pattern
+// to lower case and splits it in labels. The parameters
+// can have the string (default) or the int type. It
+// returns an error if a label is malformed or a parameter
+// is repeated.
+func parseHostPattern(pattern string) ([]segment, error) {
+	pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+	if pattern == "" {
+		return nil, fmt.Errorf("host pattern must not be empty")
+	}
+	names := make(map[string]bool)
+	labels := make([]segment, 0)
+	for _, label := range strings.Split(pattern, ".") {
+		if !strings.HasPrefix(label, "{") && !strings.HasSuffix(label, "}") {
+			if label == "" {
+				return nil, fmt.Errorf("host pattern %q has an empty label", pattern)
+			}
+			labels = append(labels, segment{kind: staticSegment, value: label})
+			continue
+		}
+		if !strings.HasPrefix(label, "{") || !strings.HasSuffix(label, "}") {
+			return nil, fmt.Errorf("host pattern %q has a malformed parameter %q", pattern, label)
+		}
+		name, paramType, _ := strings.Cut(label[1:len(label)-1], ":")
+		if paramType == "" {
+			paramType = "string"
+		}
+		if name == "" || names[name] {
+			return nil, fmt.Errorf("host pattern %q has a parameter without name or repeated", pattern)
+		}
+		if paramType != "string" && paramType != "int" {
+			return nil, fmt.Errorf("host pattern %q uses the unsupported parameter type %q", pattern, paramType)
+		}
+		names[name] = true
+		labels = append(labels, segment{
+			kind:      paramSegment,
+			value:     name,
+			paramType: paramType,
+			convert:   paramTypes[paramType],
+		})
+	}
+	return labels, nil
+}
+
+// The shape function returns the host pattern with the
+// parameter names removed, e.g. {string}.example.test for
+// {tenant}.example.test. Two patterns with the same shape
+// match the same hosts.
+func shape(labels []segment) string {
+	parts := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if label.kind == staticSegment {
+			parts = append(parts, label.value)
+			continue
+		}
+		parts = append(parts, "{"+label.paramType+"}")
+	}
+	return strings.Join(parts, ".")
+}
+
+// The staticLabels function counts the static labels of a
+// host pattern. The patterns with more static labels are
+// more specific, so they are tried first.
+func staticLabels(labels []segment) int {
+	count := 0
+	for _, label := range labels {
+		if label.kind == staticSegment {
+			count++
+		}
+	}
+	return count
+}
+
+// The match method reports whether the host matches the
+// pattern of the table and stores the captured labels in
+// params.
+func (h *hostTable) match(host string, params Params) bool {
+	parts := strings.Split(host, ".")
+	if len(parts) != len(h.labels) {
+		return false
+	}
+	captured := make(Params)
+	for index, label := range h.labels {
+		if label.kind == staticSegment {
+			if label.value != parts[index] {
+				return false
+			}
+			continue
+		}
+		value, ok := label.convert(parts[index])
+		if !ok {
+			return false
+		}
+		captured[label.value] = value
+	}
+	for name, value := range captured {
+		params[name] = value
+	}
+	return true
+}
+
+// The hostTable method returns the table of the host
+// pattern, creating it in the right priority position
+// when it does not exist. The conflicts between the
+// patterns are found by check.
+func (t *routingTable) hostTable(pattern string, labels []segment) *hostTable {
+	for _, existing := range t.hosts {
+		if existing.pattern == pattern {
+			return existing
+		}
+	}
+	created := &hostTable{pattern: pattern, labels: labels, root: newNode(segment{})}
+	created.root.gen = t.gen
+	t.hosts = append(t.hosts, created)
+	sort.SliceStable(t.hosts, func(i, j int) bool {
+		return staticLabels(t.hosts[i].labels) > staticLabels(t.hosts[j].labels)
+	})
+	return created
+}
+
+// The hostRoot method returns the root of the tree of the
+// first host pattern which matches the host, storing the
+// captured labels in params, or nil if none matches.
+func (t *routingTable) hostRoot(host string, params Params) *node {
+	for _, table := range t.hosts {
+		if table.match(host, params) {
+			return table.root
+		}
+	}
+	return nil
+}
+
+// The requestHost function returns the host of the request
+// without the port, in lower case and without the
+// trailing dot, ready to be matched.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostFallback(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	s.Handle(http.MethodGet, "/customer/{id:int}", namedHandler("default"))
+	s.Handle(http.MethodGet, "/", namedHandler("home"))
+	tenants := s.Host("{tenant}.example.test")
+	tenants.Handle(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ := GetParams(r).GetString("tenant")
+		w.Write([]byte("tenant " + tenant))
+	})
+	tenants.Handle(http.MethodPost, "/customer/{id:int}", namedHandler("tenant post"))
+
+	tests := []struct {
+		method string
+		target string
+		status int
+		body   string
+		allow  string
+	}{
+		{http.MethodGet, "http://acme.example.test/", http.StatusOK, "tenant acme", ""},
+		// The host has no GET route for the path, so the
+		// default one answers.
+		{http.MethodGet, "http://acme.example.test/customer/1", http.StatusOK, "default", ""},
+		{http.MethodHead, "http://acme.example.test/customer/1", http.StatusOK, "default", ""},
+		{http.MethodPost, "http://acme.example.test/customer/1", http.StatusOK, "tenant post", ""},
+		{http.MethodDelete, "http://acme.example.test/customer/1", http.StatusMethodNotAllowed, "", "GET, HEAD, OPTIONS, POST"},
+		{http.MethodOptions, "http://acme.example.test/customer/1", http.StatusNoContent, "", "GET, HEAD, OPTIONS, POST"},
+		{http.MethodGet, "http://acme.example.test/missing", http.StatusNotFound, "", ""},
+		{http.MethodGet, "http://other.test/", http.StatusOK, "home", ""},
+		{http.MethodPost, "http://other.test/customer/1", http.StatusMethodNotAllowed, "", "GET, HEAD, OPTIONS"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(test.method, test.target, nil))
+		if w.Code != test.status || w.Header().Get("Allow") != test.allow {
+			t.Errorf("%s %s answered %d with Allow %q, want %d with %q",
+				test.method, test.target, w.Code, w.Header().Get("Allow"), test.status, test.allow)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s %s answered %q, want %q", test.method, test.target, w.Body.String(), test.body)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cUpgradeMaxBody is the largest body of a request which
+// asks for the upgrade to h2c, which is read in memory
+// before the connection is upgraded.
+const h2cUpgradeMaxBody = 1 << 20
+
+// WithH2C makes the server speak HTTP/2 over cleartext
+// (h2c), besides HTTP/1.1, e.g. behind a load balancer
+// which terminates TLS. The clients can start the
+// connection with the HTTP/2 preface (prior knowledge),
+// or send an HTTP/1.1 request with the Upgrade: h2c
+// header, which is answered over HTTP/2 on the same
+// connection. HTTP/2 over TLS is always enabled.
+func WithH2C() Option {
+	return func(s *Server) {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		s.httpServer.Protocols = protocols
+		if s.h2c == nil {
+			s.h2c = newH2CUpgrader()
+			s.httpServer.RegisterOnShutdown(s.h2c.startShutdown)
+		}
+	}
+}
+
+// The h2cUpgrader serves the connections upgraded from
+// HTTP/1.1 to h2c, which net/http does not support. It
+// uses the h2c handler of golang.org/x/net, which hijacks
+// the connections, so the http.Server does not know them:
+// the upgrader tells them to stop when the server shuts
+// down, waits for them and closes the ones left when the
+// shutdown deadline expires. The HTTP/2 settings are read
+// from the http.Server.
+type h2cUpgrader struct {
+	server *http2.Server
+	// The graceful shutdown of the HTTP/2 connections is
+	// registered by http2.ConfigureServer in the shutdown
+	// hooks of this server, which serves nothing else.
+	companion *http.Server
+	mu        sync.Mutex
+	conns     map[net.Conn]bool
+	served    sync.WaitGroup
+}
+
+// The newH2CUpgrader function creates an upgrader without
+// connections.
+func newH2CUpgrader() *h2cUpgrader {
+	upgrader := &h2cUpgrader{
+		server:    new(http2.Server),
+		companion: new(http.Server),
+		conns:     make(map[net.Conn]bool),
+	}
+	// The error is only about the cipher suites of the
+	// TLSConfig, which the companion does not have.
+	http2.ConfigureServer(upgrader.companion, upgrader.server)
+	return upgrader
+}
+
+// The wrap method returns the handler which upgrades the
+// requests with the Upgrade: h2c header and serves the
+// connection over HTTP/2 with handler, which also serves
+// the other requests.
+func (u *h2cUpgrader) wrap(handler http.Handler) http.Handler {
+	upgrade := h2c.NewHandler(handler, u.server)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !asksH2CUpgrade(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h2cUpgradeMaxBody)
+		tracked := &h2cHijacker{ResponseWriter: w, upgrader: u}
+		defer tracked.release()
+		upgrade.ServeHTTP(tracked, r)
+	})
+}
+
+// The asksH2CUpgrade function reports whether the request
+// has h2c among the protocols of its Upgrade header. The
+// other upgrades, e.g. to WebSocket, are left to the
+// handlers.
+func asksH2CUpgrade(r *http.Request) bool {
+	for _, value := range r.Header.Values("Upgrade") {
+		for _, protocol := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(protocol), "h2c") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The startShutdown method sends GOAWAY to the upgraded
+// connections, so they close once their requests in
+// progress finish.
+func (u *h2cUpgrader) startShutdown() {
+	u.companion.Shutdown(context.Background())
+}
+
+// The drain method waits until the upgraded connections
+// are closed or ctx is done. Then it closes the remaining
+// ones and returns the error of ctx.
+func (u *h2cUpgrader) drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		u.served.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		u.mu.Lock()
+		for conn := range u.conns {
+			conn.Close()
+		}
+		u.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// The h2cHijacker records the connection hijacked by the
+// h2c handler in the upgrader until it is served.
+type h2cHijacker struct {
+	http.ResponseWriter
+	upgrader *h2cUpgrader
+	conn     net.Conn
+}
+
+// The Hijack method takes over the connection and records
+// it. The http.Server waits for the request until then, so
+// the connection is recorded before the server shutdown
+// waits for the upgraded ones.
+func (h *h2cHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(h.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	h.conn = conn
+	h.upgrader.mu.Lock()
+	h.upgrader.conns[conn] = true
+	h.upgrader.mu.Unlock()
+	h.upgrader.served.Add(1)
+	return conn, rw, nil
+}
+
+// The release method forgets the connection once it is
+// served.
+func (h *h2cHijacker) release() {
+	if h.conn == nil {
+		return
+	}
+	h.upgrader.mu.Lock()
+	delete(h.upgrader.conns, h.conn)
+	h.upgrader.mu.Unlock()
+	h.upgrader.served.Done()
+}
+
+// The Unwrap method returns the wrapped writer, for
+// http.ResponseController.
+func (h *h2cHijacker) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+// WithHTTP2MaxConcurrentStreams sets the maximum number of
+// requests a client can send at the same time on an
+// HTTP/2 connection, 250 by default.
+func WithHTTP2MaxConcurrentStreams(streams int) Option {
+	return func(s *Server) {
+		s.http2Config().MaxConcurrentStreams = streams
+	}
+}
+
+// WithHTTP2MaxReadFrameSize sets the largest HTTP/2 frame
+// the server accepts, between 16 KiB and 16 MiB, 1 MiB by
+// default. An invalid size uses the default one.
+func WithHTTP2MaxReadFrameSize(size int) Option {
+	return func(s *Server) {
+		s.http2Config().MaxReadFrameSize = size
+	}
+}
+
+// The http2Config method returns the HTTP/2 settings of
+// the http.Server, creating them the first time.
+func (s *Server) http2Config() *http.HTTP2Config {
+	if s.httpServer.HTTP2 == nil {
+		s.httpServer.HTTP2 = &http.HTTP2Config{}
+	}
+	return s.httpServer.HTTP2
+}
+
+// The http2EnvOptions function reads the HTTP/2
+// configuration from the environment variables:
+//
+//   - SERVER_H2C, true to accept HTTP/2 over cleartext,
+//   - SERVER_HTTP2_MAX_CONCURRENT_STREAMS and
+//     SERVER_HTTP2_MAX_READ_FRAME_SIZE, with integers.
+func http2EnvOptions() ([]Option, error) {
+	options := make([]Option, 0)
+	if value := os.Getenv("SERVER_H2C"); value != "" {
+		h2c, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("SERVER_H2C: %w", err)
+		}
+		if h2c {
+			options = append(options, WithH2C())
+		}
+	}
+	integers := []struct {
+		key    string
+		option func(int) Option
+	}{
+		{"SERVER_HTTP2_MAX_CONCURRENT_STREAMS", WithHTTP2MaxConcurrentStreams},
+		{"SERVER_HTTP2_MAX_READ_FRAME_SIZE", WithHTTP2MaxReadFrameSize},
+	}
+	for _, integer := range integers {
+		value := os.Getenv(integer.key)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", integer.key, err)
+		}
+		options = append(options, integer.option(number))
+	}
+	return options, nil
+}
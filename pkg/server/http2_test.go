@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2cRequests is the number of requests sent at the same
+// time on one connection.
+const h2cRequests = 5
+
+// The barrier holds the requests until all of them
+// arrive, to prove they are served at the same time.
+type barrier struct {
+	mu      sync.Mutex
+	arrived int
+	all     chan struct{}
+}
+
+// The wait method reports whether all the requests arrived
+// before the timeout.
+func (b *barrier) wait() bool {
+	b.mu.Lock()
+	b.arrived++
+	if b.arrived == h2cRequests {
+		close(b.all)
+	}
+	b.mu.Unlock()
+	select {
+	case <-b.all:
+		return true
+	case <-time.After(2 * time.Second):
+		return false
+	}
+}
+
+// The startH2CServer function runs a server with h2c and
+// the /customer/{id:int} route, which answers once
+// h2cRequests requests arrived. It returns the address,
+// the function which sets a new barrier and the server.
+func startH2CServer(t *testing.T) (string, func(), *Server) {
+	t.Helper()
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := free.Addr().String()
+	free.Close()
+
+	var mu sync.Mutex
+	var current *barrier
+	reset := func() {
+		mu.Lock()
+		current = &barrier{all: make(chan struct{})}
+		mu.Unlock()
+	}
+	reset()
+	s := NewServer(addr, WithH2C())
+	s.Handle(http.MethodGet, "/customer/{id:int}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		b := current
+		mu.Unlock()
+		if !b.wait() {
+			http.Error(w, "the requests were not served at the same time", http.StatusServiceUnavailable)
+			return
+		}
+		id, _ := GetParams(r).GetInt("id")
+		fmt.Fprintf(w, "%s customer %d", r.Proto, id)
+	})
+	go s.Run(context.Background())
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("the server does not listen: %v", err)
+		}
+	}
+	return addr, reset, s
+}
+
+func TestH2C(t *testing.T) {
+	addr, reset, s := startH2CServer(t)
+
+	t.Run("prior knowledge", func(t *testing.T) {
+		reset()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		clientConn, err := (&http2.Transport{AllowHTTP: true}).NewClientConn(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for id := range h2cRequests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/customer/%d", addr, id), nil)
+				response, err := clientConn.RoundTrip(request)
+				if err != nil {
+					t.Errorf("GET /customer/%d returned the error %v", id, err)
+					return
+				}
+				defer response.Body.Close()
+				body, _ := io.ReadAll(response.Body)
+				if want := fmt.Sprintf("HTTP/2.0 customer %d", id); response.StatusCode != http.StatusOK || string(body) != want {
+					t.Errorf("GET /customer/%d answered %d %q, want %q", id, response.StatusCode, body, want)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("upgrade", func(t *testing.T) {
+		reset()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		fmt.Fprintf(conn, "GET /customer/0 HTTP/1.1\r\nHost: %s\r\n"+
+			"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n\r\n", addr)
+		reader := bufio.NewReader(conn)
+		response, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("the upgrade was answered with %d, want 101", response.StatusCode)
+		}
+
+		// The upgrade request is the stream 1, the next
+		// requests are sent at once on the odd streams.
+		conn.Write([]byte(http2.ClientPreface))
+		framer := http2.NewFramer(conn, reader)
+		framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+		framer.WriteSettings()
+		var block bytes.Buffer
+		encoder := hpack.NewEncoder(&block)
+		for id := 1; id < h2cRequests; id++ {
+			block.Reset()
+			encoder.WriteField(hpack.HeaderField{Name: ":method", Value: http.MethodGet})
+			encoder.WriteField(hpack.HeaderField{Name: ":scheme", Value: "http"})
+			encoder.WriteField(hpack.HeaderField{Name: ":authority", Value: addr})
+			encoder.WriteField(hpack.HeaderField{Name: ":path", Value: fmt.Sprintf("/customer/%d", id)})
+			framer.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      uint32(2*id + 1),
+				BlockFragment: block.Bytes(),
+				EndStream:     true,
+				EndHeaders:    true,
+			})
+		}
+
+		statuses := make(map[uint32]string)
+		bodies := make(map[uint32]string)
+		for ended := 0; ended < h2cRequests; {
+			frame, err := framer.ReadFrame()
+			if err != nil {
+				t.Fatalf("reading the answers returned the error %v", err)
+			}
+			switch frame := frame.(type) {
+			case *http2.SettingsFrame:
+				if !frame.IsAck() {
+					framer.WriteSettingsAck()
+				}
+			case *http2.MetaHeadersFrame:
+				statuses[frame.StreamID] = frame.PseudoValue("status")
+				if frame.StreamEnded() {
+					ended++
+				}
+			case *http2.DataFrame:
+				bodies[frame.StreamID] += string(frame.Data())
+				if frame.StreamEnded() {
+					ended++
+				}
+			case *http2.GoAwayFrame:
+				t.Fatalf("the server closed the connection with %v", frame.ErrCode)
+			}
+		}
+		for id := range h2cRequests {
+			streamID := uint32(2*id + 1)
+			// The upgrade request was sent with HTTP/1.1, but
+			// it is answered over HTTP/2.
+			want := fmt.Sprintf("HTTP/2.0 customer %d", id)
+			if id == 0 {
+				want = "HTTP/1.1 customer 0"
+			}
+			if statuses[streamID] != "200" || bodies[streamID] != want {
+				t.Errorf("GET /customer/%d answered %s %q, want %q", id, statuses[streamID], bodies[streamID], want)
+			}
+		}
+
+		// The shutdown tells the upgraded connection to stop
+		// and waits until it is closed.
+		shutdownErr := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			shutdownErr <- s.Shutdown(ctx)
+		}()
+		for goAway := false; !goAway; {
+			frame, err := framer.ReadFrame()
+			if err != nil {
+				t.Fatalf("the connection was closed without GOAWAY: %v", err)
+			}
+			_, goAway = frame.(*http2.GoAwayFrame)
+		}
+		if err := <-shutdownErr; err != nil {
+			t.Errorf("Shutdown returned the error %v", err)
+		}
+	})
+}
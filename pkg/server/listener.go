@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net"
+	"sync"
+)
+
+// The limitListener wraps a net.Listener to accept at
+// most a fixed number of connections at the same time.
+// The semaphore channel has a slot for each connection:
+// Accept takes a slot and closing the connection gives
+// it back.
+type limitListener struct {
+	net.Listener
+	semaphore chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// The newLimitListener function returns a listener which
+// accepts at most limit simultaneous connections from the
+// provided listener.
+func newLimitListener(listener net.Listener, limit int) *limitListener {
+	return &limitListener{
+		Listener:  listener,
+		semaphore: make(chan struct{}, limit),
+		done:      make(chan struct{}),
+	}
+}
+
+// The Accept method waits for a free slot and then for
+// the next connection. It stops waiting if the listener
+// is closed.
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.semaphore <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.semaphore
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.semaphore }}, nil
+}
+
+// The Close method closes the underlying listener and
+// wakes up the Accept calls waiting for a slot.
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+// The limitConn is a connection accepted by a
+// limitListener. It gives back its slot once, the first
+// time it is closed.
+type limitConn struct {
+	net.Conn
+	release   func()
+	closeOnce sync.Once
+}
+
+// The Close method closes the connection and releases
+// its slot in the listener.
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// anyMethod is the key used in the routes of a node for a
+// handler mounted with Mount, which answers every HTTP
+// method.
+const anyMethod = "*"
+
+// mountParam is the name of the wildcard which captures
+// the part of the URL path below the mount prefix.
+const mountParam = "mountPath"
+
+// The Mount method plugs an http.Handler (e.g., a
+// third-party app, net/http/pprof or a file browser)
+// under the prefix. The handler answers every HTTP method
+// and receives the requests with the prefix removed from
+// the URL path, so with the prefix /admin a request to
+// /admin/users arrives as /users and a request to /admin
+// as /. The mount is a route of the router, so the paths
+// outside the prefix still get the router 404 and 405
+// answers, the global middlewares run before it and the
+// routes registered with Handle below the prefix take
+// precedence over it. Mount panics if the prefix is not a
+// valid pattern.
+func (s *Server) Mount(prefix string, handler http.Handler) *Route {
+	return s.mount(nil, "", prefix, handler, nil)
+}
+
+// The Mount method plugs an http.Handler under the group
+// prefix joined with prefix. The group middlewares wrap
+// the handler. See Server.Mount.
+func (g *Group) Mount(prefix string, handler http.Handler) *Route {
+	rte := g.server.mount(g.batch, g.host, g.prefix+prefix, handler, g.middlewares)
+	g.track(rte)
+	return rte
+}
+
+// The mount method registers the handler under the prefix
+// of the host for every method, wrapped by the
+// middlewares, in the batch if one is given, and panics
+// if it cannot be added.
+func (s *Server) mount(batch *routeBatch, host, prefix string, handler http.Handler, middlewares []types.Middleware) *Route {
+	pattern := strings.TrimSuffix(prefix, "/") + "/{" + mountParam + ":*}"
+	return s.handle(batch, host, anyMethod, pattern, mountHandler(handler), middlewares)
+}
+
+// The mountHandler function adapts a mounted handler to
+// the router: it rebuilds the URL path from the part
+// captured below the mount prefix before calling the
+// handler. When the path has escaped characters, like
+// %2F, the raw path keeps the same suffix, so the
+// handler sees the original encoding. The request is
+// cloned, so the original one is not modified.
+func mountHandler(handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest, _ := GetParams(r).GetString(mountParam)
+		mounted := r.Clone(r.Context())
+		mounted.URL.Path = "/" + strings.TrimPrefix(rest, "/")
+		mounted.URL.RawPath = rawSuffix(r.URL.RawPath, mounted.URL.Path)
+		handler.ServeHTTP(w, mounted)
+	}
+}
+
+// The rawSuffix function returns the suffix of the raw
+// path, starting at a slash, which unescapes to path, or
+// an empty string if there is none.
+func rawSuffix(rawPath, path string) string {
+	for i := 0; i < len(rawPath); i++ {
+		if rawPath[i] != '/' {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(rawPath[i:]); err == nil && unescaped == path {
+			return rawPath[i:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The echoRequest handler answers with the method, the
+// path, the raw path and the query of the request it
+// receives.
+var echoRequest = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "%s %s %s %s", r.Method, r.URL.Path, r.URL.RawPath, r.URL.RawQuery)
+})
+
+func TestMount(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	s.Mount("/admin/", echoRequest)
+	s.Group("/tenant/{id}", traceMiddleware("tenant")).Mount("/files", echoRequest)
+	s.Handle(http.MethodGet, "/admin/stats", namedHandler("stats"))
+	s.Handle(http.MethodGet, "/other", namedHandler("other"))
+
+	tests := []struct {
+		method, target string
+		status         int
+		body           string
+		trace          string
+	}{
+		// The prefix is removed from the path and the raw
+		// path, the query is kept.
+		{http.MethodGet, "/admin", http.StatusOK, "GET /  ", ""},
+		{http.MethodGet, "/admin/", http.StatusOK, "GET /  ", ""},
+		{http.MethodGet, "/admin/users?page=2", http.StatusOK, "GET /users  page=2", ""},
+		{http.MethodGet, "/admin/users/", http.StatusOK, "GET /users/  ", ""},
+		{http.MethodGet, "/admin/a%2Fb", http.StatusOK, "GET /a/b /a%2Fb ", ""},
+		{http.MethodGet, "/tenant/a%20b/files/c%2Fd", http.StatusOK, "GET /c/d /c%2Fd ", "tenant"},
+		// Every method reaches the mount.
+		{http.MethodPost, "/admin/users", http.StatusOK, "POST /users  ", ""},
+		{http.MethodDelete, "/admin/users/1", http.StatusOK, "DELETE /users/1  ", ""},
+		{"PURGE", "/admin/cache", http.StatusOK, "PURGE /cache  ", ""},
+		{http.MethodOptions, "/admin/users", http.StatusOK, "OPTIONS /users  ", ""},
+		// The routes below the prefix take precedence, the
+		// mount answers their other methods.
+		{http.MethodGet, "/admin/stats", http.StatusOK, "stats", ""},
+		{http.MethodHead, "/admin/stats", http.StatusOK, "stats", ""},
+		{http.MethodPost, "/admin/stats", http.StatusOK, "POST /stats  ", ""},
+		// The paths outside the prefix are answered by the
+		// router.
+		{http.MethodOptions, "/other", http.StatusNoContent, "", ""},
+		{http.MethodPost, "/other", http.StatusMethodNotAllowed, "", ""},
+		{http.MethodGet, "/administrator", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.Handler().ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, nil))
+			if recorder.Code != test.status {
+				t.Fatalf("the status is %d, want %d", recorder.Code, test.status)
+			}
+			if test.status == http.StatusOK && recorder.Body.String() != test.body {
+				t.Errorf("the body is %q, want %q", recorder.Body.String(), test.body)
+			}
+			if trace := recorder.Header().Get("X-Trace"); trace != test.trace {
+				t.Errorf("the trace is %q, want %q", trace, test.trace)
+			}
+			if test.status != http.StatusOK && test.status != http.StatusNotFound {
+				if allow := recorder.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+					t.Errorf("the Allow header is %q, want %q", allow, "GET, HEAD, OPTIONS")
+				}
+			}
+		})
+	}
+}
+
+func TestMountDoesNotModifyRequest(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	var original *http.Request
+	s.Use(func(nextHandler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			original = r
+			nextHandler(w, r)
+		}
+	})
+	s.Mount("/admin", echoRequest)
+	s.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/a%2Fb", nil))
+	if original.URL.Path != "/admin/a/b" || original.URL.RawPath != "/admin/a%2Fb" {
+		t.Errorf("the mount changed the request path to %q (raw %q)", original.URL.Path, original.URL.RawPath)
+	}
+}
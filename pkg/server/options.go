@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The Option type represents a function which changes
+// the configuration of a Server. The options are passed
+// to NewServer, e.g.
+// NewServer(":3000", WithReadTimeout(10*time.Second)).
+type Option func(*Server)
+
+// The default limits of the server. They protect the
+// server against clients which open connections and send
+// or read the data very slowly (e.g., slowloris attacks).
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 15 * time.Second
+	defaultWriteTimeout      = 15 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+// WithReadHeaderTimeout sets the maximum time to read the
+// headers of a request.
+func WithReadHeaderTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.httpServer.ReadHeaderTimeout = timeout
+	}
+}
+
+// WithReadTimeout sets the maximum time to read a whole
+// request, including the body.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.httpServer.ReadTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the maximum time from the end of
+// the request headers until the response is written.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.httpServer.WriteTimeout = timeout
+	}
+}
+
+// WithIdleTimeout sets the maximum time to wait for the
+// next request on a keep-alive connection.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.httpServer.IdleTimeout = timeout
+	}
+}
+
+// WithShutdownTimeout sets the maximum time to wait for
+// the requests in progress and the shutdown hooks when
+// the server shuts down.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// WithMaxHeaderBytes sets the maximum size in bytes of
+// the request headers.
+func WithMaxHeaderBytes(size int) Option {
+	return func(s *Server) {
+		s.httpServer.MaxHeaderBytes = size
+	}
+}
+
+// WithMaxConnections limits the number of connections
+// open at the same time. When the limit is reached, new
+// connections wait until another one is closed. Zero,
+// the default, means no limit.
+func WithMaxConnections(limit int) Option {
+	return func(s *Server) {
+		s.maxConnections = limit
+	}
+}
+
+// EnvOptions reads the server limits from the environment
+// variables and returns them as options. The variables
+// are optional, the ones which are not set keep the
+// default values:
+//
+//   - SERVER_READ_HEADER_TIMEOUT, SERVER_READ_TIMEOUT,
+//     SERVER_WRITE_TIMEOUT, SERVER_IDLE_TIMEOUT and
+//     SERVER_SHUTDOWN_TIMEOUT, with durations like 5s
+//     or 1m,
+//   - SERVER_HEALTH_CHECK_TIMEOUT and SERVER_DRAIN_DELAY,
+//     with durations too,
+//   - SERVER_MAX_HEADER_BYTES, SERVER_MAX_CONNECTIONS and
+//     SERVER_STATIC_GZIP_MIN_SIZE, with integers,
+//   - SERVER_SOCKET_MODE, with the octal permissions of the
+//     Unix domain socket like 0660,
+//   - SERVER_PREFORK, with the number of worker processes
+//     or auto for one per CPU, and
+//     SERVER_PREFORK_STATUS_ADDR, with the address of the
+//     status of the workers,
+//   - SERVER_PROXY_PROTOCOL_TRUSTED, with the comma
+//     separated networks allowed to send the PROXY protocol
+//     header, like 10.0.0.0/8,
+//   - the HTTP/2 variables described in http2EnvOptions,
+//   - the HTTPS variables described in tlsEnvOptions.
+//
+// It returns an error if a variable has a wrong value.
+func EnvOptions() ([]Option, error) {
+	options := make([]Option, 0)
+	durations := []struct {
+		key    string
+		option func(time.Duration) Option
+	}{
+		{"SERVER_READ_HEADER_TIMEOUT", WithReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT", WithReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", WithWriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", WithIdleTimeout},
+		{"SERVER_SHUTDOWN_TIMEOUT", WithShutdownTimeout},
+		{"SERVER_HEALTH_CHECK_TIMEOUT", WithHealthCheckTimeout},
+		{"SERVER_DRAIN_DELAY", WithDrainDelay},
+	}
+	for _, duration := range durations {
+		value := os.Getenv(duration.key)
+		if value == "" {
+			continue
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", duration.key, err)
+		}
+		options = append(options, duration.option(timeout))
+	}
+
+	integers := []struct {
+		key    string
+		option func(int) Option
+	}{
+		{"SERVER_MAX_HEADER_BYTES", WithMaxHeaderBytes},
+		{"SERVER_MAX_CONNECTIONS", WithMaxConnections},
+		{"SERVER_STATIC_GZIP_MIN_SIZE", WithStaticGzipMinSize},
+	}
+	for _, integer := range integers {
+		value := os.Getenv(integer.key)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", integer.key, err)
+		}
+		options = append(options, integer.option(number))
+	}
+
+	if value := os.Getenv("SERVER_SOCKET_MODE"); value != "" {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("SERVER_SOCKET_MODE: %w", err)
+		}
+		options = append(options, WithSocketMode(fs.FileMode(mode)))
+	}
+
+	switch value := os.Getenv("SERVER_PREFORK"); value {
+	case "", "0":
+	case "auto":
+		options = append(options, WithPrefork(0))
+	default:
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 0 {
+			return nil, fmt.Errorf("SERVER_PREFORK: use a number of workers or auto, not %q", value)
+		}
+		options = append(options, WithPrefork(workers))
+	}
+	if value := os.Getenv("SERVER_PREFORK_STATUS_ADDR"); value != "" {
+		options = append(options, WithPreforkStatusAddr(value))
+	}
+
+	if value := os.Getenv("SERVER_PROXY_PROTOCOL_TRUSTED"); value != "" {
+		trusted, err := parseCIDRs(value)
+		if err != nil {
+			return nil, fmt.Errorf("SERVER_PROXY_PROTOCOL_TRUSTED: %w", err)
+		}
+		options = append(options, WithProxyProtocol(trusted...))
+	}
+
+	http2Options, err := http2EnvOptions()
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, http2Options...)
+
+	tlsOptions, err := tlsEnvOptions()
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, tlsOptions...)
+
+	return options, nil
+}
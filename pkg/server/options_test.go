@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerTimeouts(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	if s.httpServer.ReadHeaderTimeout != defaultReadHeaderTimeout || s.httpServer.ReadTimeout != defaultReadTimeout ||
+		s.httpServer.WriteTimeout != defaultWriteTimeout || s.httpServer.IdleTimeout != defaultIdleTimeout {
+		t.Errorf("the server has the timeouts %+v, want the defaults", s.httpServer)
+	}
+
+	t.Setenv("SERVER_READ_HEADER_TIMEOUT", "1s")
+	t.Setenv("SERVER_READ_TIMEOUT", "2s")
+	t.Setenv("SERVER_WRITE_TIMEOUT", "3s")
+	t.Setenv("SERVER_IDLE_TIMEOUT", "4s")
+	t.Setenv("SERVER_SHUTDOWN_TIMEOUT", "5s")
+	t.Setenv("SERVER_MAX_HEADER_BYTES", "2048")
+	t.Setenv("SERVER_MAX_CONNECTIONS", "10")
+	options, err := EnvOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = NewServer("127.0.0.1:0", options...)
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"ReadHeaderTimeout", s.httpServer.ReadHeaderTimeout, time.Second},
+		{"ReadTimeout", s.httpServer.ReadTimeout, 2 * time.Second},
+		{"WriteTimeout", s.httpServer.WriteTimeout, 3 * time.Second},
+		{"IdleTimeout", s.httpServer.IdleTimeout, 4 * time.Second},
+		{"shutdownTimeout", s.shutdownTimeout, 5 * time.Second},
+		{"MaxHeaderBytes", s.httpServer.MaxHeaderBytes, 2048},
+		{"maxConnections", s.maxConnections, 10},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s is %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestEnvOptionsErrors(t *testing.T) {
+	for key, value := range map[string]string{
+		"SERVER_READ_TIMEOUT":     "15",
+		"SERVER_MAX_CONNECTIONS":  "many",
+		"SERVER_SHUTDOWN_TIMEOUT": "-",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := EnvOptions(); err == nil {
+				t.Errorf("EnvOptions with %s=%s returned no error", key, value)
+			}
+		})
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := newLimitListener(inner, 1)
+	defer listener.Close()
+	for range 2 {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+	}
+
+	first, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+	select {
+	case <-accepted:
+		t.Fatal("a second connection was accepted over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Closing the first connection frees its slot, once.
+	first.Close()
+	first.Close()
+	select {
+	case conn := <-accepted:
+		if conn == nil {
+			t.Fatal("the second Accept failed")
+		}
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("the second connection was not accepted after the first one was closed")
+	}
+	if len(listener.semaphore) != 0 {
+		t.Errorf("%d slots are still taken", len(listener.semaphore))
+	}
+
+	// Close wakes up an Accept waiting for a slot.
+	held, _ := net.Dial("tcp", inner.Addr().String())
+	defer held.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		listener.Close()
+	}()
+	if _, err := listener.Accept(); err == nil {
+		t.Error("Accept on a closed listener returned no error")
+	}
+}
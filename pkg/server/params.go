@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+// paramsKey is the unexported type used as key to store
+// the path parameters in the request context, so it
+// cannot collide with keys defined in other packages.
+type paramsKey struct{}
+
+// Params holds the path parameters captured by the router
+// for the current request. The keys are the names declared
+// in the route pattern (e.g., {id:int}) and the values are
+// already converted to the declared type.
+type Params map[string]any
+
+// GetParams returns the path parameters captured by the
+// router for the request r. If the route has no parameters
+// an empty Params is returned, so it is always safe to
+// call its methods.
+func GetParams(r *http.Request) Params {
+	params, ok := r.Context().Value(paramsKey{}).(Params)
+	if !ok {
+		return Params{}
+	}
+	return params
+}
+
+// withParams returns a shallow copy of r whose context
+// carries the provided path parameters.
+func withParams(r *http.Request, params Params) *http.Request {
+	if len(params) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, params))
+}
+
+// Get returns the value of the parameter name and a boolean
+// indicating whether the parameter was captured.
+func (p Params) Get(name string) (any, bool) {
+	value, exists := p[name]
+	return value, exists
+}
+
+// GetInt returns the value of an int parameter (e.g.,
+// {id:int}). The boolean is false when the parameter does
+// not exist or was not declared as int.
+func (p Params) GetInt(name string) (int, bool) {
+	value, ok := p[name].(int)
+	return value, ok
+}
+
+// GetString returns the value of a parameter stored as
+// string (e.g., {slug} or {orderID:uuid}). The boolean is
+// false when the parameter does not exist or is not a string.
+func (p Params) GetString(name string) (string, bool) {
+	value, ok := p[name].(string)
+	return value, ok
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	params := Params{"id": 7, "slug": "hello"}
+
+	if value, ok := params.GetInt("id"); !ok || value != 7 {
+		t.Errorf("GetInt(id) = (%v, %v), want (7, true)", value, ok)
+	}
+	if _, ok := params.GetInt("slug"); ok {
+		t.Error("GetInt(slug) succeeded on a string parameter")
+	}
+	if value, ok := params.GetString("slug"); !ok || value != "hello" {
+		t.Errorf("GetString(slug) = (%q, %v), want (hello, true)", value, ok)
+	}
+	if _, ok := params.GetString("id"); ok {
+		t.Error("GetString(id) succeeded on an int parameter")
+	}
+	if _, ok := params.Get("missing"); ok {
+		t.Error("Get(missing) found a parameter which does not exist")
+	}
+}
+
+func TestGetParams(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if params := GetParams(r); params == nil || len(params) != 0 {
+		t.Errorf("GetParams of a request without parameters = %v, want an empty Params", params)
+	}
+	if withParams(r, Params{}) != r {
+		t.Error("withParams copied the request for empty parameters")
+	}
+	r = withParams(r, Params{"id": 1})
+	if value, ok := GetParams(r).GetInt("id"); !ok || value != 1 {
+		t.Errorf("GetParams(r).GetInt(id) = (%v, %v), want (1, true)", value, ok)
+	}
+}
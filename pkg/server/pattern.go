@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The paramConverter validates the raw text of a path
+// segment and converts it to the Go value exposed
+// through Params. It returns false when the text does
+// not belong to the parameter type.
+type paramConverter func(raw string) (any, bool)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// paramTypes stores the types that can be declared in a
+// route pattern with the {name:type} syntax. A parameter
+// without type (e.g., {slug}) uses the string type.
+var paramTypes = map[string]paramConverter{
+	"string": func(raw string) (any, bool) {
+		return raw, raw != ""
+	},
+	"int": func(raw string) (any, bool) {
+		for _, char := range raw {
+			if char < '0' || char > '9' {
+				return nil, false
+			}
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, false
+		}
+		return value, true
+	},
+	"uuid": func(raw string) (any, bool) {
+		if !uuidRegexp.MatchString(raw) {
+			return nil, false
+		}
+		return strings.ToLower(raw), true
+	},
+}
+
+// paramPriority sets the order in which the router tries
+// the parameter types when several of them are declared in
+// the same position. The more restrictive types go first.
+var paramPriority = map[string]int{
+	"int":    0,
+	"uuid":   1,
+	"string": 2,
+}
+
+// The segmentKind classifies the segments of a route
+// pattern.
+type segmentKind int
+
+const (
+	staticSegment segmentKind = iota
+	paramSegment
+	wildcardSegment
+)
+
+// The segment represents one part of a route pattern
+// between slashes. A static segment must be equal to
+// the path segment, a parameter segment captures the path
+// segment and converts it with its converter, and a
+// wildcard segment captures the rest of the path.
+type segment struct {
+	kind      segmentKind
+	value     string
+	paramType string
+	convert   paramConverter
+}
+
+// The parsePattern function splits a route pattern like
+// /customer/{id:int}/orders/{orderID:uuid} into segments.
+// A parameter declared with the * type (e.g.,
+// /resources/{filepath:*}) is a wildcard which captures
+// the rest of the path, so it must be the last segment.
+// It returns an error when the pattern does not start
+// with a slash, a parameter is malformed, its type is
+// unknown or the same parameter name is used twice.
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q must start with /", pattern)
+	}
+	names := make(map[string]bool)
+	parts := splitPath(pattern)
+	segments := make([]segment, 0, len(parts))
+	for index, part := range parts {
+		if !strings.HasPrefix(part, "{") && !strings.HasSuffix(part, "}") {
+			segments = append(segments, segment{kind: staticSegment, value: part})
+			continue
+		}
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			return nil, fmt.Errorf("pattern %q has a malformed parameter %q", pattern, part)
+		}
+		name, paramType, _ := strings.Cut(part[1:len(part)-1], ":")
+		if paramType == "" {
+			paramType = "string"
+		}
+		if name == "" {
+			return nil, fmt.Errorf("pattern %q has a parameter without name", pattern)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("pattern %q repeats the parameter %q", pattern, name)
+		}
+		if paramType == "*" {
+			if index != len(parts)-1 {
+				return nil, fmt.Errorf("pattern %q must end with the wildcard %q", pattern, name)
+			}
+			names[name] = true
+			segments = append(segments, segment{kind: wildcardSegment, value: name, paramType: paramType})
+			continue
+		}
+		convert, typeExists := paramTypes[paramType]
+		if !typeExists {
+			return nil, fmt.Errorf("pattern %q uses the unknown parameter type %q", pattern, paramType)
+		}
+		names[name] = true
+		segments = append(segments, segment{
+			kind:      paramSegment,
+			value:     name,
+			paramType: paramType,
+			convert:   convert,
+		})
+	}
+	return segments, nil
+}
+
+// The splitPath function returns the parts of an URL path
+// between slashes, ignoring the leading one. So "/" gives
+// [] and "/customer/1/" gives ["customer", "1", ""], which
+// keeps a trailing slash significant when matching.
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []segment
+	}{
+		{"/", []segment{}},
+		{"/customer", []segment{{kind: staticSegment, value: "customer"}}},
+		{"/customer/", []segment{{kind: staticSegment, value: "customer"}, {kind: staticSegment, value: ""}}},
+		{"/customer/{id:int}", []segment{
+			{kind: staticSegment, value: "customer"},
+			{kind: paramSegment, value: "id", paramType: "int"},
+		}},
+		{"/blog/{slug}", []segment{
+			{kind: staticSegment, value: "blog"},
+			{kind: paramSegment, value: "slug", paramType: "string"},
+		}},
+		{"/orders/{orderID:uuid}/{rest:*}", []segment{
+			{kind: staticSegment, value: "orders"},
+			{kind: paramSegment, value: "orderID", paramType: "uuid"},
+			{kind: wildcardSegment, value: "rest", paramType: "*"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			segments, err := parsePattern(test.pattern)
+			if err != nil {
+				t.Fatalf("parsePattern(%q) returned the error %v", test.pattern, err)
+			}
+			if len(segments) != len(test.want) {
+				t.Fatalf("parsePattern(%q) returned %d segments, want %d", test.pattern, len(segments), len(test.want))
+			}
+			for index, seg := range segments {
+				want := test.want[index]
+				if seg.kind != want.kind || seg.value != want.value || seg.paramType != want.paramType {
+					t.Errorf("segment %d of %q is %+v, want %+v", index, test.pattern, seg, want)
+				}
+				if seg.kind == paramSegment && seg.convert == nil {
+					t.Errorf("segment %d of %q has no converter", index, test.pattern)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePatternErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		message string
+	}{
+		{"customer", "must start with /"},
+		{"", "must start with /"},
+		{"/customer/{id", "malformed parameter"},
+		{"/customer/id}", "malformed parameter"},
+		{"/customer/{}", "without name"},
+		{"/customer/{:int}", "without name"},
+		{"/customer/{id}/{id:int}", "repeats the parameter"},
+		{"/customer/{id:float}", "unknown parameter type"},
+		{"/files/{path:*}/edit", "must end with the wildcard"},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			_, err := parsePattern(test.pattern)
+			if err == nil {
+				t.Fatalf("parsePattern(%q) returned no error", test.pattern)
+			}
+			if !strings.Contains(err.Error(), test.message) {
+				t.Errorf("parsePattern(%q) returned %q, want it to contain %q", test.pattern, err, test.message)
+			}
+		})
+	}
+}
+
+func TestParamTypes(t *testing.T) {
+	tests := []struct {
+		paramType string
+		raw       string
+		want      any
+		ok        bool
+	}{
+		{"int", "42", 42, true},
+		{"int", "007", 7, true},
+		{"int", "-1", nil, false},
+		{"int", "+1", nil, false},
+		{"int", "1e3", nil, false},
+		{"int", "", nil, false},
+		{"int", "99999999999999999999999", nil, false},
+		{"uuid", "123e4567-e89b-12d3-a456-426614174000", "123e4567-e89b-12d3-a456-426614174000", true},
+		{"uuid", "123E4567-E89B-12D3-A456-426614174000", "123e4567-e89b-12d3-a456-426614174000", true},
+		{"uuid", "123e4567e89b12d3a456426614174000", nil, false},
+		{"uuid", "123e4567-e89b-12d3-a456-42661417400g", nil, false},
+		{"uuid", "x123e4567-e89b-12d3-a456-426614174000", nil, false},
+		{"string", "hello", "hello", true},
+		{"string", "", nil, false},
+	}
+	for _, test := range tests {
+		value, ok := paramTypes[test.paramType](test.raw)
+		if ok != test.ok || (ok && value != test.want) {
+			t.Errorf("the %s converter of %q returned (%v, %v), want (%v, %v)",
+				test.paramType, test.raw, value, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"", []string{}},
+		{"/", []string{}},
+		{"/customer", []string{"customer"}},
+		{"/customer/1/", []string{"customer", "1", ""}},
+		{"//a", []string{"", "a"}},
+	}
+	for _, test := range tests {
+		if got := splitPath(test.path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitPath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// preforkWorkerEnv marks the processes started by the
+// prefork supervisor, and has the index of the worker.
+const preforkWorkerEnv = "SERVER_PREFORK_WORKER"
+
+// The backoff of the worker restarts: the first restart
+// waits the minimum, and every quick exit doubles the wait
+// up to the maximum. A worker which runs longer than the
+// maximum is considered healthy and resets it.
+const (
+	minRestartBackoff = 100 * time.Millisecond
+	maxRestartBackoff = 30 * time.Second
+)
+
+// The worker states shown in the prefork status.
+const (
+	workerStarting   = "starting"
+	workerRunning    = "running"
+	workerRestarting = "restarting"
+	workerStopped    = "stopped"
+)
+
+// The WorkerStatus describes a worker process of the
+// prefork mode.
+type WorkerStatus struct {
+	Index     int       `json:"index"`
+	PID       int       `json:"pid"`
+	State     string    `json:"state"`
+	StartedAt time.Time `json:"started_at"`
+	Restarts  int       `json:"restarts"`
+	// LastExit is the reason of the last exit, e.g. exit
+	// status 2, empty if the worker never exited.
+	LastExit string `json:"last_exit,omitempty"`
+}
+
+// The PreforkStatus aggregates the status of the workers
+// of the prefork mode.
+type PreforkStatus struct {
+	Workers  int            `json:"workers"`
+	Running  int            `json:"running"`
+	Restarts int            `json:"restarts"`
+	Details  []WorkerStatus `json:"details"`
+}
+
+// The preforkState is the state of the prefork supervisor.
+type preforkState struct {
+	mu      sync.Mutex
+	workers []WorkerStatus
+}
+
+// WithPrefork makes the server run in prefork mode: the
+// process becomes a supervisor which starts the workers,
+// copies of the executable which share the port with
+// SO_REUSEPORT, so they use all the cores with isolated
+// heaps and a crash stops a single worker. The workers
+// which exit are restarted with an increasing delay, and
+// the shutdown signals are forwarded to them. Zero or a
+// negative number starts one worker per CPU. It is not
+// supported with Unix domain sockets nor on Windows.
+func WithPrefork(workers int) Option {
+	return func(s *Server) {
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		s.preforkWorkers = workers
+	}
+}
+
+// WithPreforkStatusAddr sets the address (e.g.,
+// 127.0.0.1:9090) where the prefork supervisor answers
+// GET /workers with the status of the workers as JSON.
+func WithPreforkStatusAddr(addr string) Option {
+	return func(s *Server) {
+		s.preforkStatusAddr = addr
+	}
+}
+
+// The isPreforkWorker function reports whether the process
+// is a worker started by the prefork supervisor.
+func isPreforkWorker() bool {
+	return os.Getenv(preforkWorkerEnv) != ""
+}
+
+// The PreforkStatus method returns the status of the
+// workers of the prefork mode, which is empty when the
+// process is not the supervisor.
+func (s *Server) PreforkStatus() PreforkStatus {
+	s.prefork.mu.Lock()
+	defer s.prefork.mu.Unlock()
+	status := PreforkStatus{
+		Workers: len(s.prefork.workers),
+		Details: append([]WorkerStatus{}, s.prefork.workers...),
+	}
+	for _, worker := range s.prefork.workers {
+		if worker.State == workerRunning {
+			status.Running++
+		}
+		status.Restarts += worker.Restarts
+	}
+	return status
+}
+
+// The updateWorker method changes the status of the
+// worker index.
+func (s *Server) updateWorker(index int, change func(*WorkerStatus)) {
+	s.prefork.mu.Lock()
+	defer s.prefork.mu.Unlock()
+	change(&s.prefork.workers[index])
+}
+
+// The preforkStatusHandler answers the status of the
+// workers as JSON.
+func (s *Server) preforkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/workers" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s.PreforkStatus())
+}
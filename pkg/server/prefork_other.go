@@ -0,0 +1,24 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// errPreforkUnsupported is returned on the systems without
+// SO_REUSEPORT.
+var errPreforkUnsupported = errors.New("the prefork mode is not supported on this system")
+
+// The listenReusePort function is not supported on this
+// system.
+func listenReusePort(addr string) (net.Listener, error) {
+	return nil, errPreforkUnsupported
+}
+
+// The supervise method is not supported on this system.
+func (s *Server) supervise(ctx context.Context) error {
+	return errPreforkUnsupported
+}
@@ -0,0 +1,171 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The listenReusePort function listens on the TCP address
+// with the SO_REUSEPORT option, so all the workers can
+// listen on the same port and the kernel spreads the
+// connections among them.
+func listenReusePort(addr string) (net.Listener, error) {
+	config := net.ListenConfig{
+		Control: func(network, address string, conn syscall.RawConn) error {
+			var optionErr error
+			err := conn.Control(func(fd uintptr) {
+				optionErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			})
+			return errors.Join(err, optionErr)
+		},
+	}
+	return config.Listen(context.Background(), "tcp", addr)
+}
+
+// The supervise method is the Run of the prefork
+// supervisor. It starts the workers and restarts the ones
+// which exit until ctx is canceled or the process receives
+// SIGINT or SIGTERM. Then it forwards SIGTERM to the
+// workers, which shut down gracefully, kills the ones
+// still running after the shutdown timeout and runs the
+// shutdown hooks.
+func (s *Server) supervise(ctx context.Context) error {
+	if strings.HasPrefix(s.port, unixPrefix) {
+		return errors.New("the prefork mode needs a TCP address")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s.prefork.workers = make([]WorkerStatus, s.preforkWorkers)
+	var wg sync.WaitGroup
+	for index := range s.preforkWorkers {
+		s.prefork.workers[index] = WorkerStatus{Index: index, State: workerStarting}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.superviseWorker(ctx, executable, index)
+		}()
+	}
+
+	var statusServer *http.Server
+	if s.preforkStatusAddr != "" {
+		statusServer = &http.Server{
+			Addr:              s.preforkStatusAddr,
+			Handler:           http.HandlerFunc(s.preforkStatusHandler),
+			ReadHeaderTimeout: s.httpServer.ReadHeaderTimeout,
+		}
+		go func() {
+			if err := statusServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Println("The prefork status server stopped: ", err)
+			}
+		}()
+	}
+	log.Printf("%s with %d workers", s.String(), s.preforkWorkers)
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down the workers")
+	wg.Wait()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	var statusErr error
+	if statusServer != nil {
+		statusErr = statusServer.Shutdown(shutdownCtx)
+	}
+	return errors.Join(statusErr, s.runShutdownHooks(shutdownCtx))
+}
+
+// The superviseWorker method runs the worker index,
+// restarting it with backoff every time it exits, until
+// ctx is done.
+func (s *Server) superviseWorker(ctx context.Context, executable string, index int) {
+	backoff := minRestartBackoff
+	attr := &os.ProcAttr{
+		Env:   append(os.Environ(), preforkWorkerEnv+"="+strconv.Itoa(index)),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	}
+	for {
+		startedAt := time.Now()
+		process, err := os.StartProcess(executable, os.Args, attr)
+		exited := make(chan error, 1)
+		if err == nil {
+			s.updateWorker(index, func(worker *WorkerStatus) {
+				worker.PID = process.Pid
+				worker.State = workerRunning
+				worker.StartedAt = startedAt
+			})
+			go func() {
+				state, err := process.Wait()
+				if err == nil {
+					err = errors.New(state.String())
+				}
+				exited <- err
+			}()
+			select {
+			case err = <-exited:
+			case <-ctx.Done():
+				s.stopWorker(process, exited)
+				s.updateWorker(index, func(worker *WorkerStatus) {
+					worker.State = workerStopped
+				})
+				return
+			}
+		}
+
+		if time.Since(startedAt) > maxRestartBackoff {
+			backoff = minRestartBackoff
+		}
+		log.Printf("Worker %d exited (%v), restarting in %s", index, err, backoff)
+		s.updateWorker(index, func(worker *WorkerStatus) {
+			worker.State = workerRestarting
+			worker.Restarts++
+			worker.LastExit = err.Error()
+		})
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			s.updateWorker(index, func(worker *WorkerStatus) {
+				worker.State = workerStopped
+			})
+			return
+		}
+		backoff = min(2*backoff, maxRestartBackoff)
+	}
+}
+
+// The stopWorker method sends SIGTERM to the worker and
+// waits until it exits, killing it after the shutdown
+// timeout.
+func (s *Server) stopWorker(process *os.Process, exited <-chan error) {
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		log.Println(fmt.Errorf("stopping the worker %d: %w", process.Pid, err))
+	}
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-exited:
+	case <-timer.C:
+		process.Kill()
+		<-exited
+	}
+}
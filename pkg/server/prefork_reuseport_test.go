@@ -0,0 +1,143 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// The freeAddr function returns a TCP address of the
+// loopback interface which is not in use.
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// The TestPrefork test runs the test binary as the
+// workers of a supervisor. The workers serve HTTPS and
+// redirect HTTP to it, both on ports shared by all of
+// them, and one of them crashes on request.
+func TestPrefork(t *testing.T) {
+	if isPreforkWorker() {
+		preforkWorker()
+		return
+	}
+	// The workers run the executable with the arguments of
+	// this process, so they only run this test.
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestPrefork$"}
+	defer func() { os.Args = args }()
+	addr, redirectAddr := freeAddr(t), freeAddr(t)
+	t.Setenv("TEST_PREFORK_ADDR", addr)
+	t.Setenv("TEST_PREFORK_REDIRECT_ADDR", redirectAddr)
+
+	s := NewServer(addr, WithPrefork(2), WithShutdownTimeout(5*time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		select {
+		case err := <-runErr:
+			if err != nil {
+				t.Errorf("Run returned %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Error("the supervisor did not stop the workers")
+		}
+		if status := s.PreforkStatus(); status.Running != 0 {
+			t.Errorf("%d workers are still running after the shutdown", status.Running)
+		}
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: time.Second,
+	}
+	get := func(url string) (*http.Response, string, error) {
+		response, err := client.Get(url)
+		if err != nil {
+			return nil, "", err
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		return response, string(body), err
+	}
+	waitFor := func(what string, ready func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); !ready(); time.Sleep(20 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for %s, the status is %+v", what, s.PreforkStatus())
+			}
+		}
+	}
+	waitFor("the workers", func() bool {
+		_, _, err := get("https://" + addr + "/")
+		return err == nil && s.PreforkStatus().Running == 2
+	})
+
+	// Both workers listen on the shared ports, so none of
+	// them exits.
+	time.Sleep(500 * time.Millisecond)
+	if status := s.PreforkStatus(); status.Running != 2 || status.Restarts != 0 {
+		t.Fatalf("the workers restarted before any crash: %+v", status)
+	}
+	response, _, err := get("http://" + redirectAddr + "/customer/1?tab=orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://" + addr + "/customer/1?tab=orders"; response.StatusCode != http.StatusMovedPermanently ||
+		response.Header.Get("Location") != want {
+		t.Errorf("the redirect is %d to %q, want 301 to %q", response.StatusCode, response.Header.Get("Location"), want)
+	}
+
+	// A worker which exits is restarted. A POST request is
+	// not retried on another worker when the connection
+	// breaks, unlike a GET.
+	if response, err := client.Post("https://"+addr+"/crash", "text/plain", nil); err == nil {
+		response.Body.Close()
+	}
+	waitFor("the restart", func() bool {
+		status := s.PreforkStatus()
+		return status.Restarts == 1 && status.Running == 2
+	})
+	for _, worker := range s.PreforkStatus().Details {
+		if worker.Restarts == 1 && worker.LastExit != "exit status 3" {
+			t.Errorf("the last exit of the restarted worker is %q, want exit status 3", worker.LastExit)
+		}
+	}
+}
+
+// The preforkWorker function is the worker process of
+// TestPrefork.
+func preforkWorker() {
+	s := NewServer(os.Getenv("TEST_PREFORK_ADDR"), WithPrefork(2), WithSelfSignedCertificate(),
+		WithHTTPSRedirect(os.Getenv("TEST_PREFORK_REDIRECT_ADDR")))
+	s.Handle(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, os.Getpid())
+	})
+	s.Handle(http.MethodPost, "/crash", func(w http.ResponseWriter, r *http.Request) {
+		os.Exit(3)
+	})
+	if err := s.Run(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, "worker:", err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyV2Signature starts the header of the version 2 of
+// the PROXY protocol.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// The PROXY protocol limits: the longest version 1 header
+// and the fixed part of a version 2 header.
+const (
+	proxyV1MaxLength    = 107
+	proxyV2HeaderLength = 16
+)
+
+// defaultProxyHeaderTimeout is the maximum time to read
+// the PROXY protocol header when the server has no read
+// header timeout.
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+// WithProxyProtocol makes the server read the PROXY
+// protocol header (versions 1 and 2), sent by TCP load
+// balancers like HAProxy before the request, from the
+// connections of the trusted networks. The client address
+// of the header becomes the RemoteAddr of the requests.
+// The connections from the trusted networks without a
+// valid header are closed. The other connections are
+// served as usual, so a header sent by them is not
+// believed and makes the request fail.
+func WithProxyProtocol(trusted ...netip.Prefix) Option {
+	return func(s *Server) {
+		s.proxyTrusted = append(s.proxyTrusted, trusted...)
+	}
+}
+
+// The parseCIDRs function parses a comma separated list of
+// networks like 10.0.0.0/8,192.168.1.10/32.
+func parseCIDRs(value string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0)
+	for _, cidr := range strings.Split(value, ",") {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// The proxyListener wraps a net.Listener to read the PROXY
+// protocol header of the connections from the trusted
+// networks.
+type proxyListener struct {
+	net.Listener
+	trusted       []netip.Prefix
+	headerTimeout time.Duration
+}
+
+// The newProxyListener function returns a listener which
+// reads the PROXY protocol header of the connections from
+// the trusted networks within the header timeout.
+func newProxyListener(listener net.Listener, trusted []netip.Prefix, headerTimeout time.Duration) *proxyListener {
+	if headerTimeout <= 0 {
+		headerTimeout = defaultProxyHeaderTimeout
+	}
+	return &proxyListener{Listener: listener, trusted: trusted, headerTimeout: headerTimeout}
+}
+
+// The Accept method waits for the next connection. The
+// header is read later, in the goroutine which serves the
+// connection, so a slow client does not block the others.
+func (pl *proxyListener) Accept() (net.Conn, error) {
+	conn, err := pl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !pl.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn), headerTimeout: pl.headerTimeout}, nil
+}
+
+// The isTrusted method reports whether the address belongs
+// to a trusted network.
+func (pl *proxyListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range pl.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// The proxyConn is a connection from a trusted network.
+// Its header is read the first time the address or the
+// data are needed, and the data come after it.
+type proxyConn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+	once          sync.Once
+	remoteAddr    net.Addr
+	headerErr     error
+}
+
+// The readHeader method reads the header once, and logs
+// and closes the connection if it is not valid.
+func (pc *proxyConn) readHeader() {
+	pc.once.Do(func() {
+		pc.Conn.SetReadDeadline(time.Now().Add(pc.headerTimeout))
+		pc.remoteAddr, pc.headerErr = readProxyHeader(pc.reader)
+		pc.Conn.SetReadDeadline(time.Time{})
+		if pc.headerErr != nil {
+			pc.headerErr = fmt.Errorf("PROXY protocol header from %s: %w", pc.Conn.RemoteAddr(), pc.headerErr)
+			log.Println(pc.headerErr)
+			pc.Conn.Close()
+		}
+	})
+}
+
+// The RemoteAddr method returns the client address of the
+// header, or the address of the load balancer when the
+// header has none (e.g. its health checks).
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	pc.readHeader()
+	if pc.remoteAddr == nil {
+		return pc.Conn.RemoteAddr()
+	}
+	return pc.remoteAddr
+}
+
+// The Read method reads the data which follow the header.
+func (pc *proxyConn) Read(data []byte) (int, error) {
+	pc.readHeader()
+	if pc.headerErr != nil {
+		return 0, pc.headerErr
+	}
+	return pc.reader.Read(data)
+}
+
+// The readProxyHeader function reads a version 1 or 2
+// header and returns the client address, nil if the
+// header does not carry one.
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	start, err := reader.Peek(len(proxyV2Signature))
+	switch {
+	case bytes.Equal(start, proxyV2Signature):
+		return readProxyV2(reader)
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		return readProxyV1(reader)
+	case err != nil:
+		return nil, err
+	}
+	return nil, errors.New("missing header")
+}
+
+// The readProxyV1 function reads a text header like
+// "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\n".
+func readProxyV1(reader *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for {
+		char, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, char)
+		if char == '\n' {
+			break
+		}
+		if len(line) == proxyV1MaxLength {
+			return nil, errors.New("version 1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("version 1 header must end with CRLF")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed version 1 header %q", line)
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil || ip.Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("malformed version 1 source address %q", fields[2])
+	}
+	if _, err := netip.ParseAddr(fields[3]); err != nil {
+		return nil, fmt.Errorf("malformed version 1 destination address %q", fields[3])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("malformed version 1 source port %q", fields[4])
+	}
+	if _, err := strconv.ParseUint(fields[5], 10, 16); err != nil {
+		return nil, fmt.Errorf("malformed version 1 destination port %q", fields[5])
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// The readProxyV2 function reads a binary header. The LOCAL
+// command, used by the health checks of the load
+// balancer, and the address families other than TCP over
+// IPv4 and IPv6 carry no client address. The TLVs after
+// the addresses are skipped.
+func readProxyV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, proxyV2HeaderLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported version 2 header version %d", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	if command > 1 {
+		return nil, fmt.Errorf("unsupported version 2 command %d", command)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	if command == 0 {
+		return nil, nil
+	}
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("version 2 IPv4 addresses too short")
+		}
+		ip := netip.AddrFrom4([4]byte(payload[0:4]))
+		port := binary.BigEndian.Uint16(payload[8:10])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, port)), nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("version 2 IPv6 addresses too short")
+		}
+		ip := netip.AddrFrom16([16]byte(payload[0:16]))
+		port := binary.BigEndian.Uint16(payload[32:34])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, port)), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProxyV1(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"tcp4", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\n", "203.0.113.7:51234"},
+		{"tcp6", "PROXY TCP6 2001:db8::7 2001:db8::1 51234 443\r\n", "[2001:db8::7]:51234"},
+		{"unknown", "PROXY UNKNOWN\r\n", ""},
+		{"unknown with addresses", "PROXY UNKNOWN 203.0.113.7 10.0.0.1 51234 443\r\n", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(test.header + "GET / HTTP/1.1\r\n"))
+			addr, err := readProxyHeader(reader)
+			if err != nil {
+				t.Fatalf("readProxyHeader returned the error %v", err)
+			}
+			if got := addrString(addr); got != test.want {
+				t.Errorf("readProxyHeader returned the address %q, want %q", got, test.want)
+			}
+			if rest, _ := reader.ReadString('\n'); rest != "GET / HTTP/1.1\r\n" {
+				t.Errorf("the data after the header is %q", rest)
+			}
+		})
+	}
+}
+
+func TestReadProxyV1Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"missing header", "GET / HTTP/1.1\r\n"},
+		{"empty", ""},
+		{"no CRLF", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\n"},
+		{"too long", "PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLength) + "\r\n"},
+		{"unterminated", "PROXY TCP4 203.0.113.7"},
+		{"bad protocol", "PROXY UDP4 203.0.113.7 10.0.0.1 51234 443\r\n"},
+		{"missing field", "PROXY TCP4 203.0.113.7 10.0.0.1 51234\r\n"},
+		{"bad source", "PROXY TCP4 203.0.113.300 10.0.0.1 51234 443\r\n"},
+		{"family mismatch", "PROXY TCP4 2001:db8::7 10.0.0.1 51234 443\r\n"},
+		{"bad destination", "PROXY TCP4 203.0.113.7 host 51234 443\r\n"},
+		{"bad source port", "PROXY TCP4 203.0.113.7 10.0.0.1 65536 443\r\n"},
+		{"bad destination port", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 -1\r\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if addr, err := readProxyHeader(bufio.NewReader(strings.NewReader(test.header))); err == nil {
+				t.Errorf("readProxyHeader(%q) = %v, want an error", test.header, addr)
+			}
+		})
+	}
+}
+
+// The proxyV2Header function builds a version 2 header
+// with the version and command byte, the family byte and
+// the payload.
+func proxyV2Header(versionCommand, family byte, payload []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, versionCommand, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return append(header, payload...)
+}
+
+// The proxyV2Addresses function builds the payload of the
+// addresses of a version 2 header.
+func proxyV2Addresses(source, destination netip.AddrPort) []byte {
+	payload := append(source.Addr().AsSlice(), destination.Addr().AsSlice()...)
+	payload = binary.BigEndian.AppendUint16(payload, source.Port())
+	return binary.BigEndian.AppendUint16(payload, destination.Port())
+}
+
+func TestReadProxyV2(t *testing.T) {
+	ipv4 := proxyV2Addresses(netip.MustParseAddrPort("203.0.113.7:51234"), netip.MustParseAddrPort("10.0.0.1:443"))
+	ipv6 := proxyV2Addresses(netip.MustParseAddrPort("[2001:db8::7]:51234"), netip.MustParseAddrPort("[2001:db8::1]:443"))
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"tcp4", proxyV2Header(0x21, 0x11, ipv4), "203.0.113.7:51234"},
+		{"tcp6", proxyV2Header(0x21, 0x21, ipv6), "[2001:db8::7]:51234"},
+		{"tcp4 with TLVs", proxyV2Header(0x21, 0x11, append(ipv4, 0x04, 0x00, 0x01, 0xff)), "203.0.113.7:51234"},
+		{"local", proxyV2Header(0x20, 0x00, nil), ""},
+		{"local with addresses", proxyV2Header(0x20, 0x11, ipv4), ""},
+		{"udp4", proxyV2Header(0x21, 0x12, ipv4), ""},
+		{"unix", proxyV2Header(0x21, 0x31, make([]byte, 216)), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := bufio.NewReader(bytes.NewReader(append(test.header, "GET"...)))
+			addr, err := readProxyHeader(reader)
+			if err != nil {
+				t.Fatalf("readProxyHeader returned the error %v", err)
+			}
+			if got := addrString(addr); got != test.want {
+				t.Errorf("readProxyHeader returned the address %q, want %q", got, test.want)
+			}
+			if rest, _ := io.ReadAll(reader); string(rest) != "GET" {
+				t.Errorf("the data after the header is %q", rest)
+			}
+		})
+	}
+}
+
+func TestReadProxyV2Errors(t *testing.T) {
+	ipv4 := proxyV2Addresses(netip.MustParseAddrPort("203.0.113.7:51234"), netip.MustParseAddrPort("10.0.0.1:443"))
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"version 1 byte", proxyV2Header(0x11, 0x11, ipv4)},
+		{"unknown command", proxyV2Header(0x22, 0x11, ipv4)},
+		{"short ipv4", proxyV2Header(0x21, 0x11, ipv4[:8])},
+		{"short ipv6", proxyV2Header(0x21, 0x21, ipv4)},
+		{"truncated payload", proxyV2Header(0x21, 0x11, ipv4)[:20]},
+		{"truncated header", proxyV2Header(0x21, 0x11, nil)[:14]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if addr, err := readProxyHeader(bufio.NewReader(bytes.NewReader(test.header))); err == nil {
+				t.Errorf("readProxyHeader = %v, want an error", addr)
+			}
+		})
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted string
+		send    string
+		data    string
+		addr    string
+		failure bool
+	}{
+		{"trusted with header", "127.0.0.0/8", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\nhello", "hello", "203.0.113.7:51234", false},
+		{"trusted without header", "127.0.0.0/8", "hello", "", "", true},
+		// The header of an untrusted client is not believed,
+		// it is part of the data.
+		{"untrusted with header", "10.0.0.0/8", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\nhello", "PROXY", "127.0.0.1:", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			listener := newProxyListener(inner, []netip.Prefix{netip.MustParsePrefix(test.trusted)}, 200*time.Millisecond)
+			defer listener.Close()
+			go func() {
+				client, err := net.Dial("tcp", inner.Addr().String())
+				if err != nil {
+					return
+				}
+				defer client.Close()
+				client.Write([]byte(test.send))
+				io.Copy(io.Discard, client)
+			}()
+
+			conn, err := listener.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			data := make([]byte, 5)
+			_, err = io.ReadFull(conn, data)
+			if test.failure {
+				if err == nil {
+					t.Fatalf("reading a connection without header returned %q, want an error", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reading the connection returned the error %v", err)
+			}
+			if string(data) != test.data {
+				t.Errorf("the data read is %q, want %q", data, test.data)
+			}
+			if got := conn.RemoteAddr().String(); !strings.HasPrefix(got, test.addr) {
+				t.Errorf("RemoteAddr() = %q, want %q", got, test.addr)
+			}
+		})
+	}
+}
+
+// The addrString function returns the address as text, or
+// an empty string for nil.
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
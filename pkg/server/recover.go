@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+)
+
+// requestIDHeader is the header which carries the ID of
+// a request, set by the client or a proxy in front of the
+// server.
+const requestIDHeader = "X-Request-ID"
+
+// The PanicReport describes a panic recovered while
+// serving a request, for the reporter set with
+// WithPanicReporter.
+type PanicReport struct {
+	Request *http.Request
+	// RequestID is the X-Request-ID header of the request
+	// or, if it has none, a random ID, which is sent back in
+	// the same header of the response.
+	RequestID string
+	// Value is the value given to panic.
+	Value any
+	// Stack is the stack trace of the goroutine which
+	// panicked.
+	Stack []byte
+}
+
+// The PanicReporter sends the panics recovered by the
+// server to an error tracking service or another sink. It
+// is called after the panic is logged and before the
+// internal error handler answers, so it must not write
+// the response.
+type PanicReporter func(report PanicReport)
+
+// WithPanicReporter sets the function which receives the
+// panics recovered by the server.
+func WithPanicReporter(reporter PanicReporter) Option {
+	return func(s *Server) {
+		s.panicReporter = reporter
+	}
+}
+
+// The recoverer middleware recovers the panics of the
+// handlers and the middlewares inside it. The panic is
+// logged with the request method, path, ID and the stack
+// trace, given to the panic reporter, and the request is
+// answered with the internal error handler. When the
+// response was already started a status cannot be sent,
+// so the connection is aborted instead, which the client
+// sees as a truncated response. The http.ErrAbortHandler
+// panic is the way to abort a response on purpose, so it
+// is not recovered.
+func (s *Server) recoverer(nextHandler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+			report := PanicReport{
+				Request:   r,
+				RequestID: r.Header.Get(requestIDHeader),
+				Value:     recovered,
+				Stack:     debug.Stack(),
+			}
+			if report.RequestID == "" {
+				report.RequestID = newRequestID()
+			}
+			log.Printf("panic serving %s %s (request %s): %v\n%s",
+				r.Method, r.URL.Path, report.RequestID, recovered, report.Stack)
+			if s.panicReporter != nil {
+				s.panicReporter(report)
+			}
+			if recorder.started {
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Set(requestIDHeader, report.RequestID)
+			s.internalError(w, r)
+		}()
+		nextHandler(recorder, r)
+	}
+}
+
+// The newRequestID function returns a random ID of 16
+// hexadecimal characters.
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// The statusRecorder wraps a response writer to know
+// whether the response was started. It keeps the
+// flushing and hijacking of the wrapped writer, which the
+// streaming handlers and the web sockets need.
+type statusRecorder struct {
+	http.ResponseWriter
+	started bool
+}
+
+// The WriteHeader method records that the response was
+// started and sends the status.
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.started = true
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// The Write method records that the response was started
+// and writes the body.
+func (sr *statusRecorder) Write(body []byte) (int, error) {
+	sr.started = true
+	return sr.ResponseWriter.Write(body)
+}
+
+// The Flush method sends the buffered response, if the
+// wrapped writer supports it.
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		sr.started = true
+		flusher.Flush()
+	}
+}
+
+// The ReadFrom method records that the response was
+// started and copies src to the wrapped writer, so
+// io.Copy still uses the ReadFrom of the wrapped writer
+// (e.g. sendfile for an *os.File) when it has one.
+func (sr *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	sr.started = true
+	return io.Copy(sr.ResponseWriter, src)
+}
+
+// The Hijack method lets the handler take over the
+// connection, if the wrapped writer supports it.
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	sr.started = true
+	return hijacker.Hijack()
+}
+
+// The Unwrap method returns the wrapped writer, for
+// http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
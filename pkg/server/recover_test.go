@@ -0,0 +1,50 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The readerFromRecorder is a response recorder which
+// counts the calls of its ReadFrom method.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	calls int
+}
+
+func (rf *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rf.calls++
+	return io.Copy(rf.ResponseRecorder, src)
+}
+
+func TestRecovererReadFrom(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	handlerLogic := s.recoverer(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Error("the writer given to the handler does not implement io.ReaderFrom")
+		}
+		// The reader hides the WriteTo method of the
+		// strings.Reader, which io.Copy would prefer.
+		io.Copy(w, struct{ io.Reader }{strings.NewReader("partial body")})
+		panic("failure after the body")
+	})
+	w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	// The response was started by ReadFrom, so the panic
+	// aborts it instead of answering with an error.
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("the recoverer panicked with %v, want http.ErrAbortHandler", recovered)
+		}
+		if w.calls != 1 {
+			t.Errorf("the ReadFrom of the wrapped writer was called %d times, want 1", w.calls)
+		}
+		if w.Code != http.StatusOK || w.Body.String() != "partial body" {
+			t.Errorf("the response is %d %q, want the partial body", w.Code, w.Body.String())
+		}
+	}()
+	handlerLogic(w, httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// WithCleanPathRedirect makes the router redirect the
+// requests whose path does not match any route to the
+// cleaned path, without . and .. elements and duplicate
+// slashes, when the cleaned path matches a route. For
+// example //customer/./1 is redirected to /customer/1.
+func WithCleanPathRedirect() Option {
+	return func(s *Server) {
+		s.router.cleanPath = true
+	}
+}
+
+// WithTrailingSlashRedirect makes the router redirect the
+// requests whose path does not match any route to the
+// same path with the trailing slash added or removed,
+// when that path matches a route. For example
+// /customer/1/ is redirected to /customer/1.
+func WithTrailingSlashRedirect() Option {
+	return func(s *Server) {
+		s.router.trailingSlash = true
+	}
+}
+
+// The redirectStatus function returns the status of a
+// permanent redirection for the method: 301 Moved
+// Permanently for GET and HEAD and 308 Permanent Redirect
+// for the other methods, so the clients repeat the request
+// with the same method and body.
+func redirectStatus(method string) int {
+	if method == http.MethodGet || method == http.MethodHead {
+		return http.StatusMovedPermanently
+	}
+	return http.StatusPermanentRedirect
+}
+
+// The cleanPath function returns the canonical form of an
+// URL path, like path.Clean but keeping the trailing
+// slash, which is significant for the router.
+func cleanPath(urlPath string) string {
+	if urlPath == "" {
+		return "/"
+	}
+	cleaned := path.Clean("/" + urlPath)
+	if strings.HasSuffix(urlPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// The canonicalPath method looks for the path the request
+// should be redirected to, following the redirection
+// options of the router. The path is cleaned first and
+// then the trailing slash is toggled, and the first
+// candidate registered for any method is returned. It
+// returns false when the options are disabled or no
+// candidate matches a route. The leading slashes are
+// always collapsed into one, even without
+// WithCleanPathRedirect, since a Location like
+// //evil.example/x is a URL of another host.
+func (rt *router) canonicalPath(r *http.Request) (string, bool) {
+	if !rt.cleanPath && !rt.trailingSlash {
+		return "", false
+	}
+	host := requestHost(r)
+	exists := func(candidate string) bool {
+		handlerLogic, _, allowed := rt.findHandler(r.Method, host, candidate)
+		return handlerLogic != nil || len(allowed) > 0
+	}
+	current := "/" + strings.TrimLeft(r.URL.Path, "/")
+	if rt.cleanPath {
+		current = cleanPath(current)
+		if current != r.URL.Path && exists(current) {
+			return current, true
+		}
+	}
+	if rt.trailingSlash && current != "/" {
+		toggled := current + "/"
+		if strings.HasSuffix(current, "/") {
+			toggled = strings.TrimSuffix(current, "/")
+		}
+		if exists(toggled) {
+			return toggled, true
+		}
+	}
+	return "", false
+}
+
+// The redirect method answers the request with a permanent
+// redirection to the path, keeping the query string.
+func (rt *router) redirect(w http.ResponseWriter, r *http.Request, canonical string) {
+	location := (&url.URL{Path: canonical, RawQuery: r.URL.RawQuery}).String()
+	http.Redirect(w, r, location, redirectStatus(r.Method))
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"", "/"},
+		{"/", "/"},
+		{"//customer//1", "/customer/1"},
+		{"/customer/./1/", "/customer/1/"},
+		{"/customer/../orders/", "/orders/"},
+		{"/../..", "/"},
+		{"customer/1", "/customer/1"},
+	}
+	for _, test := range tests {
+		if got := cleanPath(test.path); got != test.want {
+			t.Errorf("cleanPath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestCanonicalRedirect(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      []Option
+		method       string
+		target       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"disabled", nil, http.MethodGet, "/customer/1/", http.StatusNotFound, ""},
+		{"disabled dot", nil, http.MethodGet, "/customer/./1", http.StatusNotFound, ""},
+		{"clean", []Option{WithCleanPathRedirect()}, http.MethodGet, "//customer/./1", http.StatusMovedPermanently, "/customer/1"},
+		{"clean dot dot", []Option{WithCleanPathRedirect()}, http.MethodGet, "/orders/../customer/1", http.StatusMovedPermanently, "/customer/1"},
+		{"clean keeps the slash", []Option{WithCleanPathRedirect()}, http.MethodGet, "/customer//1/", http.StatusNotFound, ""},
+		{"add slash", []Option{WithTrailingSlashRedirect()}, http.MethodGet, "/orders", http.StatusMovedPermanently, "/orders/"},
+		{"remove slash", []Option{WithTrailingSlashRedirect()}, http.MethodGet, "/customer/1/", http.StatusMovedPermanently, "/customer/1"},
+		{"both", []Option{WithCleanPathRedirect(), WithTrailingSlashRedirect()}, http.MethodGet, "/customer//1/", http.StatusMovedPermanently, "/customer/1"},
+		{"query", []Option{WithTrailingSlashRedirect()}, http.MethodGet, "/customer/1/?tab=orders&page=2", http.StatusMovedPermanently, "/customer/1?tab=orders&page=2"},
+		{"HEAD", []Option{WithTrailingSlashRedirect()}, http.MethodHead, "/customer/1/", http.StatusMovedPermanently, "/customer/1"},
+		{"POST", []Option{WithTrailingSlashRedirect()}, http.MethodPost, "/orders", http.StatusPermanentRedirect, "/orders/"},
+		{"other method", []Option{WithTrailingSlashRedirect()}, http.MethodDelete, "/customer/1/", http.StatusPermanentRedirect, "/customer/1"},
+		{"no match", []Option{WithCleanPathRedirect(), WithTrailingSlashRedirect()}, http.MethodGet, "/missing/", http.StatusNotFound, ""},
+		// The leading slashes are collapsed even without the
+		// clean path redirect, so the Location never points
+		// to another host.
+		{"protocol-relative", []Option{WithTrailingSlashRedirect()}, http.MethodGet, "//evil.example/x/", http.StatusMovedPermanently, "/evil.example/x"},
+		{"protocol-relative clean", []Option{WithCleanPathRedirect()}, http.MethodGet, "//evil.example/x", http.StatusMovedPermanently, "/evil.example/x"},
+		{"many leading slashes", []Option{WithTrailingSlashRedirect()}, http.MethodGet, "///evil.example/x/", http.StatusMovedPermanently, "/evil.example/x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer("127.0.0.1:0", test.options...)
+			s.Handle(http.MethodGet, "/customer/{id:int}", noopHandler)
+			s.Handle(http.MethodDelete, "/customer/{id:int}", noopHandler)
+			s.Handle(http.MethodPost, "/orders/", noopHandler)
+			s.Handle(http.MethodGet, "/{site}/{page}", noopHandler)
+			recorder := httptest.NewRecorder()
+			s.Handler().ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, nil))
+			if recorder.Code != test.wantStatus || recorder.Header().Get("Location") != test.wantLocation {
+				t.Errorf("%s %s answered %d to %q, want %d to %q", test.method, test.target,
+					recorder.Code, recorder.Header().Get("Location"), test.wantStatus, test.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build (linux && !(386 || amd64 || arm)) || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package server
+
+import "syscall"
+
+// soReusePort is the SO_REUSEPORT socket option.
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,7 @@
+//go:build linux && (386 || amd64 || arm)
+
+package server
+
+// soReusePort is the SO_REUSEPORT socket option, which the
+// syscall package does not define for these architectures.
+const soReusePort = 0xf
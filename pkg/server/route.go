@@ -0,0 +1,257 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// The Route represents a routing rule registered with
+// Server.Handle or Group.Handle. It stores the HTTP
+// method, the pattern with its parsed segments and the
+// handler function. A route is immutable, its name is
+// kept in the routing table, so it can be shared by the
+// copies of the table. A route can be named, so its URL
+// can be built from the pattern with URLFor. A route
+// registered in a batch keeps it, so its name and removal
+// are part of the batch while it is open.
+type Route struct {
+	router       *router
+	batch        *routeBatch
+	host         string
+	hostLabels   []segment
+	method       string
+	pattern      string
+	segments     []segment
+	handlerLogic http.HandlerFunc
+	middlewares  []types.Middleware
+}
+
+// The RouteInfo describes a registered route for the
+// introspection of the routing table, e.g. to print it
+// at start up or to expose it in an admin page.
+type RouteInfo struct {
+	// Host is the host pattern, empty for the default
+	// routes.
+	Host string
+	// Method is the HTTP method, or ANY for a handler
+	// mounted with Mount.
+	Method  string
+	Pattern string
+	// Name is empty when the route has no name.
+	Name string
+	// Middlewares has the names of the group middlewares
+	// which wrap the route, in execution order. The global
+	// middlewares and the ones applied with AddMiddleware
+	// are not included.
+	Middlewares []string
+}
+
+// The Routes method returns the routes registered in the
+// server sorted by host, pattern and method.
+func (s *Server) Routes() []RouteInfo {
+	table := s.router.current()
+	names := make(map[*Route]string, len(table.names))
+	for name, rte := range table.names {
+		names[rte] = name
+	}
+	routes := make([]RouteInfo, 0)
+	visit := func(rte *Route) {
+		middlewareNames := make([]string, 0, len(rte.middlewares))
+		for _, middleware := range rte.middlewares {
+			middlewareNames = append(middlewareNames, middlewareName(middleware))
+		}
+		routes = append(routes, RouteInfo{
+			Host:        rte.host,
+			Method:      displayMethod(rte.method),
+			Pattern:     rte.pattern,
+			Name:        names[rte],
+			Middlewares: middlewareNames,
+		})
+	}
+	table.root.walk(visit)
+	for _, host := range table.hosts {
+		host.root.walk(visit)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// The walk method calls visit for every route registered
+// in the node and below it.
+func (n *node) walk(visit func(*Route)) {
+	for _, rte := range n.routes {
+		visit(rte)
+	}
+	for _, next := range n.staticChildren {
+		next.walk(visit)
+	}
+	for _, next := range n.paramChildren {
+		next.walk(visit)
+	}
+	if n.wildcardChild != nil {
+		n.wildcardChild.walk(visit)
+	}
+}
+
+// The displayMethod function returns the method as it is
+// shown to the developers, ANY for the mounted handlers.
+func displayMethod(method string) string {
+	if method == anyMethod {
+		return "ANY"
+	}
+	return method
+}
+
+// The middlewareName function returns the name of the
+// function which created the middleware, e.g.
+// middlewares.CheckAuth for the closure returned by
+// middlewares.CheckAuth().
+func middlewareName(middleware types.Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(middleware).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		name = name[slash+1:]
+	}
+	// The closures are named after the enclosing function
+	// with the suffixes .func1, .func2, etc.
+	if dot := strings.LastIndex(name, ".func"); dot >= 0 {
+		name = name[:dot]
+	}
+	return name
+}
+
+// The Name method sets the name used to build the URL of
+// the route with URLFor (e.g., in a template
+// {{urlFor "customer" "id" 1}}). It returns the route, so
+// it can be chained to Handle. Name panics if another route
+// already uses the name, because URLFor could not tell
+// them apart, or if the route was removed.
+func (rte *Route) Name(name string) *Route {
+	if err := rte.router.nameRoute(rte, name); err != nil {
+		panic(err)
+	}
+	return rte
+}
+
+// The nameRoute method stores the route under the name in
+// the routing table, replacing its previous name. It
+// returns an error if another route already uses the name
+// or the route is not registered.
+func (rt *router) nameRoute(rte *Route, name string) error {
+	return rt.write(rte.batch, func(t *routingTable) error {
+		return t.setName(rte, name)
+	})
+}
+
+// The setName method stores the route under the name in
+// the table (see nameRoute).
+func (t *routingTable) setName(rte *Route, name string) error {
+	if other, exists := t.names[name]; exists && other != rte {
+		return fmt.Errorf("route name %q is already used by %s %s", name, displayMethod(other.method), other.pattern)
+	}
+	if !t.contains(rte) {
+		return fmt.Errorf("route %s %s is not registered", displayMethod(rte.method), rte.pattern)
+	}
+	t.ownNames()
+	for previous, named := range t.names {
+		if named == rte {
+			delete(t.names, previous)
+		}
+	}
+	t.names[name] = rte
+	return nil
+}
+
+// The Remove method deletes the route from the routing
+// table, so the next requests do not reach it. The
+// requests in progress finish with the handler. It can be
+// called while the server is running, e.g. to disable a
+// feature, and it returns false if the route was already
+// removed.
+func (rte *Route) Remove() bool {
+	return rte.router.removeRoutes(rte.batch, rte) == 1
+}
+
+// The buildURL method replaces the parameters of the route
+// pattern with the values given in params and returns the
+// resulting URL path. Every value is formatted with
+// fmt.Sprint and validated with the parameter type, so
+// the URL built is always matched by the route. Every
+// parameter of the pattern must be given and no other.
+func (rte *Route) buildURL(params map[string]any) (string, error) {
+	var path strings.Builder
+	used := 0
+	for _, seg := range rte.segments {
+		path.WriteString("/")
+		if seg.kind == staticSegment {
+			path.WriteString(seg.value)
+			continue
+		}
+		value, exists := params[seg.value]
+		if !exists {
+			return "", fmt.Errorf("route %s requires the parameter %q", rte.pattern, seg.value)
+		}
+		used++
+		raw := fmt.Sprint(value)
+		if seg.kind == wildcardSegment {
+			parts := strings.Split(strings.TrimPrefix(raw, "/"), "/")
+			for index, part := range parts {
+				parts[index] = url.PathEscape(part)
+			}
+			path.WriteString(strings.Join(parts, "/"))
+			continue
+		}
+		if _, ok := seg.convert(raw); !ok {
+			return "", fmt.Errorf("route %s cannot use %q as the %s parameter %q",
+				rte.pattern, raw, seg.paramType, seg.value)
+		}
+		path.WriteString(url.PathEscape(raw))
+	}
+	if used != len(params) {
+		return "", fmt.Errorf("route %s got parameters which are not in its pattern", rte.pattern)
+	}
+	if path.Len() == 0 {
+		return "/", nil
+	}
+	return path.String(), nil
+}
+
+// The urlFor method looks for the route called name and
+// builds its URL. The params are key and value pairs,
+// e.g. urlFor("customer", "id", 1).
+func (rt *router) urlFor(name string, params ...any) (string, error) {
+	rte, exists := rt.current().names[name]
+	if !exists {
+		return "", fmt.Errorf("there is no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("route %q got an odd number of parameters, they must be key and value pairs", name)
+	}
+	values := make(map[string]any, len(params)/2)
+	for index := 0; index < len(params); index += 2 {
+		key, ok := params[index].(string)
+		if !ok {
+			return "", fmt.Errorf("route %q got the parameter key %v, which is not a string", name, params[index])
+		}
+		values[key] = params[index+1]
+	}
+	return rte.buildURL(values)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildURL(t *testing.T) {
+	tests := []struct {
+		pattern string
+		params  map[string]any
+		want    string
+	}{
+		{"/", nil, "/"},
+		{"/customer", nil, "/customer"},
+		{"/customer/{id:int}", map[string]any{"id": 7}, "/customer/7"},
+		{"/customer/{id:int}", map[string]any{"id": "7"}, "/customer/7"},
+		{"/blog/{slug}", map[string]any{"slug": "a b/c"}, "/blog/a%20b%2Fc"},
+		{"/orders/{orderID:uuid}", map[string]any{"orderID": "123E4567-E89B-12D3-A456-426614174000"},
+			"/orders/123E4567-E89B-12D3-A456-426614174000"},
+		{"/resources/{filepath:*}", map[string]any{"filepath": "css/styles.css"}, "/resources/css/styles.css"},
+		{"/resources/{filepath:*}", map[string]any{"filepath": "/img/a b.png"}, "/resources/img/a%20b.png"},
+	}
+	for _, test := range tests {
+		rte := mustRoute(t, test.pattern)
+		got, err := rte.buildURL(test.params)
+		if err != nil {
+			t.Errorf("buildURL(%v) of %s returned the error %v", test.params, test.pattern, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("buildURL(%v) of %s = %q, want %q", test.params, test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestBuildURLErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		params  map[string]any
+		message string
+	}{
+		{"/customer/{id:int}", nil, "requires the parameter"},
+		{"/customer/{id:int}", map[string]any{"id": "seven"}, "cannot use"},
+		{"/customer/{id:int}", map[string]any{"id": -1}, "cannot use"},
+		{"/orders/{orderID:uuid}", map[string]any{"orderID": "1"}, "cannot use"},
+		{"/blog/{slug}", map[string]any{"slug": ""}, "cannot use"},
+		{"/customer/{id:int}", map[string]any{"id": 1, "extra": 2}, "not in its pattern"},
+	}
+	for _, test := range tests {
+		rte := mustRoute(t, test.pattern)
+		_, err := rte.buildURL(test.params)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("buildURL(%v) of %s returned %v, want an error containing %q", test.params, test.pattern, err, test.message)
+		}
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	rt := NewRouter()
+	rte, err := rt.addRoute(nil, "", "GET", "/customer/{id:int}", noopHandler, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.nameRoute(rte, "customer"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rt.urlFor("customer", "id", 3); err != nil || got != "/customer/3" {
+		t.Errorf(`urlFor("customer", "id", 3) = (%q, %v), want /customer/3`, got, err)
+	}
+	for _, params := range [][]any{{"id"}, {1, 3}} {
+		if _, err := rt.urlFor("customer", params...); err == nil {
+			t.Errorf("urlFor(customer, %v) returned no error", params)
+		}
+	}
+	if _, err := rt.urlFor("missing"); err == nil {
+		t.Error("urlFor of a route which does not exist returned no error")
+	}
+}
+
+// The mustRoute function returns a route with the pattern,
+// which is not registered in any router.
+func mustRoute(t *testing.T, pattern string) *Route {
+	t.Helper()
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		t.Fatalf("parsePattern(%q) returned the error %v", pattern, err)
+	}
+	return &Route{pattern: pattern, segments: segments}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// noAuthPolicy is the auth policy of a routes file which
+// removes the policy inherited from the groups, e.g. for
+// a public route in a protected group.
+const noAuthPolicy = "none"
+
+// The Registry stores the handlers, middlewares and auth
+// policies by name, so a routes file loaded with
+// LoadRoutes can refer to them. An auth policy is a
+// middleware which decides whether the request can reach
+// the handler, e.g. a session or an API key check.
+type Registry struct {
+	handlers    map[string]http.HandlerFunc
+	middlewares map[string]types.Middleware
+	policies    map[string]types.Middleware
+}
+
+// The NewRegistry function creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers:    make(map[string]http.HandlerFunc),
+		middlewares: make(map[string]types.Middleware),
+		policies:    make(map[string]types.Middleware),
+	}
+}
+
+// The RegisterHandler method stores the handler function
+// under the name. It panics if the name is already used.
+func (reg *Registry) RegisterHandler(name string, handlerLogic http.HandlerFunc) {
+	if _, exists := reg.handlers[name]; exists {
+		panic(fmt.Sprintf("handler %q is already registered", name))
+	}
+	reg.handlers[name] = handlerLogic
+}
+
+// The RegisterMiddleware method stores the middleware
+// under the name. It panics if the name is already used.
+func (reg *Registry) RegisterMiddleware(name string, middleware types.Middleware) {
+	if _, exists := reg.middlewares[name]; exists {
+		panic(fmt.Sprintf("middleware %q is already registered", name))
+	}
+	reg.middlewares[name] = middleware
+}
+
+// The RegisterAuthPolicy method stores the middleware of
+// an auth policy under the name. It panics if the name is
+// already used or is the reserved name "none".
+func (reg *Registry) RegisterAuthPolicy(name string, policy types.Middleware) {
+	if name == noAuthPolicy {
+		panic(fmt.Sprintf("auth policy %q is reserved", name))
+	}
+	if _, exists := reg.policies[name]; exists {
+		panic(fmt.Sprintf("auth policy %q is already registered", name))
+	}
+	reg.policies[name] = policy
+}
+
+// The routeGroup is a group of a routes file, and the file
+// itself is the root group. The prefix, host, middlewares
+// and auth policy are inherited by the routes and the
+// nested groups. A disabled group disables all its
+// routes.
+type routeGroup struct {
+	Prefix      string       `json:"prefix"`
+	Host        string       `json:"host"`
+	Middlewares []string     `json:"middlewares"`
+	Auth        string       `json:"auth"`
+	Enabled     *bool        `json:"enabled"`
+	Routes      []routeEntry `json:"routes"`
+	Groups      []routeGroup `json:"groups"`
+}
+
+// The routeEntry is a route of a routes file.
+type routeEntry struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Handler     string   `json:"handler"`
+	Name        string   `json:"name"`
+	Middlewares []string `json:"middlewares"`
+	Auth        string   `json:"auth"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// The plannedRoute is a route of a routes file with its
+// names resolved with the registry, ready to be added.
+type plannedRoute struct {
+	host         string
+	method       string
+	pattern      string
+	name         string
+	handlerLogic http.HandlerFunc
+	middlewares  []types.Middleware
+	enabled      bool
+}
+
+// The LoadRoutes method reads the routes file, a JSON
+// document which declares the routes with the names of
+// their handlers, middlewares and auth policies in the
+// registry, and adds the enabled ones to the server. For
+// example:
+//
+//	{
+//	  "routes": [
+//	    {"method": "GET", "path": "/", "handler": "home", "name": "home"}
+//	  ],
+//	  "groups": [
+//	    {
+//	      "prefix": "/customer",
+//	      "auth": "authenticated",
+//	      "routes": [
+//	        {"method": "GET", "path": "/{id:int}", "handler": "customers.get"},
+//	        {"method": "DELETE", "path": "/{id:int}", "handler": "customers.delete", "enabled": false}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// The middlewares run in the order of the file, from the
+// outermost group to the route, after the auth policy.
+// The auth policy of a route or group replaces the
+// inherited one, and "none" removes it. LoadRoutes
+// returns an error, and adds no route, if the file is not
+// valid, uses a name which is not in the registry or has
+// a route which cannot be added. The disabled routes are
+// validated too, their names, patterns and conflicts
+// with the other routes, so they can be enabled safely.
+func (s *Server) LoadRoutes(filePath string, registry *Registry) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	var root routeGroup
+	if err := decoder.Decode(&root); err != nil {
+		return fmt.Errorf("routes file %s is not valid: %w", filePath, err)
+	}
+	planned, err := registry.plan(root, routeGroup{}, nil, true)
+	if err != nil {
+		return fmt.Errorf("routes file %s: %w", filePath, err)
+	}
+
+	// The routes are added in a batch, so they are published
+	// in a single swap of the routing table, or not at all.
+	// The disabled routes are added too, to check them, and
+	// removed before the batch is published.
+	batch := s.router.newBatch()
+	disabled := make([]*Route, 0)
+	for _, route := range planned {
+		rte, err := s.router.addRoute(batch, route.host, route.method, route.pattern, route.handlerLogic, route.middlewares)
+		if err == nil && route.name != "" {
+			err = s.router.nameRoute(rte, route.name)
+		}
+		if err != nil {
+			batch.done = true
+			return fmt.Errorf("routes file %s: %w", filePath, err)
+		}
+		if !route.enabled {
+			disabled = append(disabled, rte)
+		}
+	}
+	s.router.removeRoutes(batch, disabled...)
+	if err := s.router.commit(batch); err != nil {
+		return fmt.Errorf("routes file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// The plan method resolves the routes of the group and its
+// nested groups with the registry. The parent holds the
+// prefix, host and auth policy inherited by the group and
+// middlewares its inherited middlewares. It returns all
+// the routes, marking the enabled ones, or all the names
+// which are not in the registry joined in a single error.
+func (reg *Registry) plan(group, parent routeGroup, middlewares []types.Middleware, enabled bool) ([]plannedRoute, error) {
+	var errs []error
+	inherited := routeGroup{
+		Prefix: parent.Prefix + strings.TrimSuffix(group.Prefix, "/"),
+		Host:   parent.Host,
+		Auth:   parent.Auth,
+	}
+	if group.Host != "" {
+		inherited.Host = group.Host
+	}
+	if group.Auth != "" {
+		inherited.Auth = group.Auth
+	}
+	if group.Enabled != nil && !*group.Enabled {
+		enabled = false
+	}
+	groupMiddlewares, err := reg.resolveMiddlewares(group.Middlewares)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("group %s: %w", inherited.Prefix, err))
+	}
+	groupMiddlewares = append(append([]types.Middleware{}, middlewares...), groupMiddlewares...)
+
+	planned := make([]plannedRoute, 0, len(group.Routes))
+	for _, entry := range group.Routes {
+		route, err := reg.resolveRoute(entry, inherited, groupMiddlewares)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		route.enabled = enabled && (entry.Enabled == nil || *entry.Enabled)
+		planned = append(planned, route)
+	}
+	for _, nested := range group.Groups {
+		routes, err := reg.plan(nested, inherited, groupMiddlewares, enabled)
+		errs = append(errs, err)
+		planned = append(planned, routes...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return planned, nil
+}
+
+// The resolveRoute method resolves the names of the route
+// with the registry. The auth policy, if any, is the first
+// middleware of the route.
+func (reg *Registry) resolveRoute(entry routeEntry, group routeGroup, middlewares []types.Middleware) (plannedRoute, error) {
+	description := fmt.Sprintf("route %s %s", entry.Method, group.Prefix+entry.Path)
+	if entry.Method == "" || entry.Handler == "" {
+		return plannedRoute{}, fmt.Errorf("%s must have a method and a handler", description)
+	}
+	var errs []error
+	handlerLogic, exists := reg.handlers[entry.Handler]
+	if !exists {
+		errs = append(errs, fmt.Errorf("%s uses the unknown handler %q", description, entry.Handler))
+	}
+	routeMiddlewares, err := reg.resolveMiddlewares(entry.Middlewares)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", description, err))
+	}
+	auth := group.Auth
+	if entry.Auth != "" {
+		auth = entry.Auth
+	}
+	chain := make([]types.Middleware, 0, len(middlewares)+len(routeMiddlewares)+1)
+	if auth != "" && auth != noAuthPolicy {
+		policy, exists := reg.policies[auth]
+		if !exists {
+			errs = append(errs, fmt.Errorf("%s uses the unknown auth policy %q", description, auth))
+		}
+		chain = append(chain, policy)
+	}
+	chain = append(chain, middlewares...)
+	chain = append(chain, routeMiddlewares...)
+	if err := errors.Join(errs...); err != nil {
+		return plannedRoute{}, err
+	}
+	return plannedRoute{
+		host:         group.Host,
+		method:       strings.ToUpper(entry.Method),
+		pattern:      group.Prefix + entry.Path,
+		name:         entry.Name,
+		handlerLogic: handlerLogic,
+		middlewares:  chain,
+	}, nil
+}
+
+// The resolveMiddlewares method returns the middlewares
+// registered under the names, or an error with the names
+// which are not in the registry.
+func (reg *Registry) resolveMiddlewares(names []string) ([]types.Middleware, error) {
+	var errs []error
+	middlewares := make([]types.Middleware, 0, len(names))
+	for _, name := range names {
+		middleware, exists := reg.middlewares[name]
+		if !exists {
+			errs = append(errs, fmt.Errorf("unknown middleware %q", name))
+			continue
+		}
+		middlewares = append(middlewares, middleware)
+	}
+	return middlewares, errors.Join(errs...)
+}
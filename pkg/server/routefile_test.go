@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRoutes(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterHandler("customer", namedHandler("customer"))
+	tests := []struct {
+		name    string
+		content string
+		status  int
+		failure bool
+	}{
+		{"valid", `{"routes": [
+			{"method": "GET", "path": "/customer/{id:int}", "handler": "customer", "name": "customer"},
+			{"method": "PUT", "path": "/customer/{id:int}", "handler": "customer"}
+		]}`, http.StatusOK, false},
+		// The file adds no route if one of them conflicts.
+		{"conflict", `{"routes": [
+			{"method": "GET", "path": "/customer/{id:int}", "handler": "customer"},
+			{"method": "GET", "path": "/customer/{number:int}", "handler": "customer"}
+		]}`, http.StatusNotFound, true},
+		{"repeated name", `{"routes": [
+			{"method": "GET", "path": "/customer/{id:int}", "handler": "customer", "name": "customer"},
+			{"method": "PUT", "path": "/customer/{id:int}", "handler": "customer", "name": "customer"}
+		]}`, http.StatusNotFound, true},
+		{"disabled", `{"routes": [
+			{"method": "GET", "path": "/customer/{id:int}", "handler": "customer", "name": "customer", "enabled": false},
+			{"method": "PUT", "path": "/customer/{id:int}", "handler": "customer"}
+		]}`, http.StatusMethodNotAllowed, false},
+		{"disabled group", `{"groups": [
+			{"prefix": "/customer", "enabled": false, "routes": [
+				{"method": "GET", "path": "/{id:int}", "handler": "customer"}
+			]}
+		]}`, http.StatusNotFound, false},
+		// The disabled routes are checked like the enabled
+		// ones, so they can be enabled safely.
+		{"disabled invalid pattern", `{"routes": [
+			{"method": "GET", "path": "/customer/{id:int}", "handler": "customer"},
+			{"method": "GET", "path": "/orders/{id:float}", "handler": "customer", "enabled": false}
+		]}`, http.StatusNotFound, true},
+		{"disabled conflict", `{"routes": [
+			{"method": "GET", "path": "/customer/{id:int}", "handler": "customer"},
+			{"method": "GET", "path": "/customer/{number:int}", "handler": "customer", "enabled": false}
+		]}`, http.StatusNotFound, true},
+		{"disabled repeated name", `{"routes": [
+			{"method": "GET", "path": "/customer/{id:int}", "handler": "customer", "name": "customer"},
+			{"method": "PUT", "path": "/customer/{id:int}", "handler": "customer", "name": "customer", "enabled": false}
+		]}`, http.StatusNotFound, true},
+		{"disabled unknown handler", `{"routes": [
+			{"method": "GET", "path": "/customer/{id:int}", "handler": "customer"},
+			{"method": "PUT", "path": "/customer/{id:int}", "handler": "missing", "enabled": false}
+		]}`, http.StatusNotFound, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "routes.json")
+			if err := os.WriteFile(filePath, []byte(test.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			s := NewServer("127.0.0.1:0")
+			err := s.LoadRoutes(filePath, registry)
+			if (err != nil) != test.failure {
+				t.Fatalf("LoadRoutes returned the error %v", err)
+			}
+			if w := serve(s.router, http.MethodGet, "/customer/1"); w.Code != test.status {
+				t.Errorf("GET /customer/1 answered %d, want %d", w.Code, test.status)
+			}
+			if test.failure && len(s.Routes()) != 0 {
+				t.Errorf("the failed LoadRoutes added the routes %v", s.Routes())
+			}
+			if _, err := s.URLFor("customer", "id", 1); (err == nil) != (test.name == "valid") {
+				t.Errorf("URLFor of the route named customer returned the error %v", err)
+			}
+		})
+	}
+}
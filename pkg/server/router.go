@@ -1,67 +1,349 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
-	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-// The router represents the router object.
-// It has a rules field, which is a nested map used to
-// store the routing rules. The outer map uses HTTP methods
-// (e.g., GET, POST, etc.) as keys, and the inner map
-// uses URL paths as keys, with http.HandlerFunc
-// as the corresponding handler function.
+// The node represents a node of the routing tree. Every
+// node matches one segment of the URL path. The children
+// are split by kind, because the lookup tries them in a
+// fixed priority: static children first, then parameter
+// children and the wildcard child at the end. A node that
+// ends a route pattern stores its routes by HTTP method.
+// The gen is the generation of the routing table which
+// created the node, the only one allowed to modify it.
+type node struct {
+	seg            segment
+	staticChildren map[string]*node
+	paramChildren  []*node
+	wildcardChild  *node
+	routes         map[string]*Route
+	gen            uint64
+}
+
+// The newNode function creates an empty node for the
+// given segment.
+func newNode(seg segment) *node {
+	return &node{
+		seg:            seg,
+		staticChildren: make(map[string]*node),
+	}
+}
+
+// The child method returns the child of the node for
+// the segment seg, creating it when it does not exist.
+// The parameter children are kept sorted by the priority
+// of their type (see paramPriority), so the lookup order
+// does not depend on the registration order.
+func (n *node) child(seg segment) *node {
+	switch seg.kind {
+	case staticSegment:
+		if next, exists := n.staticChildren[seg.value]; exists {
+			return next
+		}
+		next := newNode(seg)
+		n.staticChildren[seg.value] = next
+		return next
+	case wildcardSegment:
+		if n.wildcardChild == nil {
+			n.wildcardChild = newNode(seg)
+		}
+		return n.wildcardChild
+	}
+	for _, next := range n.paramChildren {
+		if next.seg.value == seg.value && next.seg.paramType == seg.paramType {
+			return next
+		}
+	}
+	next := newNode(seg)
+	n.paramChildren = append(n.paramChildren, next)
+	sort.SliceStable(n.paramChildren, func(i, j int) bool {
+		return paramPriority[n.paramChildren[i].seg.paramType] < paramPriority[n.paramChildren[j].seg.paramType]
+	})
+	return next
+}
+
+// The conflict method checks whether the segment seg can
+// be added as a child of the node without making the
+// routing ambiguous. Two parameters of the same type, or
+// two wildcards, in the same position match exactly the
+// same paths, so they must have the same name. Otherwise
+// the route registered second would be shadowed by the
+// first one, or the handlers would get the value under a
+// name they do not expect.
+func (n *node) conflict(seg segment) error {
+	switch seg.kind {
+	case wildcardSegment:
+		if n.wildcardChild != nil && n.wildcardChild.seg.value != seg.value {
+			return fmt.Errorf("the wildcard %q conflicts with the wildcard %q in the same position",
+				seg.value, n.wildcardChild.seg.value)
+		}
+	case paramSegment:
+		for _, next := range n.paramChildren {
+			if next.seg.paramType == seg.paramType && next.seg.value != seg.value {
+				return fmt.Errorf("the parameter {%s:%s} conflicts with {%s:%s} in the same position, use the same name",
+					seg.value, seg.paramType, next.seg.value, next.seg.paramType)
+			}
+		}
+	}
+	return nil
+}
+
+// The route method returns the route of the node for the
+// HTTP method. A HEAD request is served by the GET route
+// when the node has no HEAD route. A handler mounted with
+// Mount answers every method, so it is the last fallback.
+func (n *node) route(method string) (*Route, bool) {
+	if rte, exists := n.routes[method]; exists {
+		return rte, true
+	}
+	if method == http.MethodHead {
+		if rte, exists := n.routes[http.MethodGet]; exists {
+			return rte, true
+		}
+	}
+	rte, exists := n.routes[anyMethod]
+	return rte, exists
+}
+
+// The match method walks the tree below the node looking
+// for a route that matches the remaining path parts and
+// has a handler for the HTTP method. When a branch does
+// not lead to a route it backtracks and tries the next
+// branch in priority order. The captured parameters are
+// accumulated in params.
+func (n *node) match(method string, parts []string, params Params) (*Route, bool) {
+	if len(parts) == 0 {
+		if rte, exists := n.route(method); exists {
+			return rte, true
+		}
+		// An empty remaining path is still a valid value
+		// for a wildcard, e.g. /resources/ with
+		// /resources/{filepath:*}.
+		if n.wildcardChild != nil {
+			if rte, exists := n.wildcardChild.route(method); exists {
+				params[n.wildcardChild.seg.value] = ""
+				return rte, true
+			}
+		}
+		return nil, false
+	}
+
+	part := parts[0]
+	if next, exists := n.staticChildren[part]; exists {
+		if found, ok := next.match(method, parts[1:], params); ok {
+			return found, true
+		}
+	}
+	for _, next := range n.paramChildren {
+		value, ok := next.seg.convert(part)
+		if !ok {
+			continue
+		}
+		if found, ok := next.match(method, parts[1:], params); ok {
+			params[next.seg.value] = value
+			return found, true
+		}
+	}
+	if n.wildcardChild != nil {
+		if rte, exists := n.wildcardChild.route(method); exists {
+			params[n.wildcardChild.seg.value] = strings.Join(parts, "/")
+			return rte, true
+		}
+	}
+	return nil, false
+}
+
+// The collectMethods method walks every branch below the
+// node that matches the remaining path parts, without the
+// priority rules of match, and adds to methods the HTTP
+// methods of all the routes found.
+func (n *node) collectMethods(parts []string, methods map[string]bool) {
+	if len(parts) == 0 {
+		for method := range n.routes {
+			methods[method] = true
+		}
+		if n.wildcardChild != nil {
+			n.wildcardChild.collectMethods(parts, methods)
+		}
+		return
+	}
+	if next, exists := n.staticChildren[parts[0]]; exists {
+		next.collectMethods(parts[1:], methods)
+	}
+	for _, next := range n.paramChildren {
+		if _, ok := next.seg.convert(parts[0]); ok {
+			next.collectMethods(parts[1:], methods)
+		}
+	}
+	if n.wildcardChild != nil {
+		for method := range n.wildcardChild.routes {
+			methods[method] = true
+		}
+	}
+}
+
+// The router represents the router object. It stores the
+// routing rules in a tree whose root matches the path
+// "/". Every pattern is parsed and inserted in the tree
+// once, when it is registered, so a lookup costs as much
+// as the number of segments of the path and not as much
+// as the number of routes.
+//
+// When several patterns match the same path the winner is
+// chosen segment by segment with the priority:
+//
+//  1. static segments (e.g. /customer/new),
+//  2. parameter segments (e.g. /customer/{id:int}), where
+//     int is tried before uuid and uuid before string,
+//  3. wildcard segments (e.g. /resources/{filepath:*}).
+//
+// The routing table can be changed while the server is
+// serving requests: the changes are applied to a copy of
+// the table, which replaces the current one atomically.
+// The copy shares the nodes which the change does not
+// touch, so a change costs as much as the path of the
+// route, and a batch (see Group.Batch) publishes many
+// changes at once. Until the router serves its first
+// request the changes are made in place on a draft table
+// instead.
+//
+// The paths which do not match any route can be
+// redirected to their canonical form, see
+// WithCleanPathRedirect and WithTrailingSlashRedirect.
 type router struct {
-	rules map[string]map[string]http.HandlerFunc
+	mu               sync.Mutex
+	table            atomic.Pointer[routingTable]
+	gen              atomic.Uint64
+	started          atomic.Bool
+	draft            *routingTable
+	notFound         http.HandlerFunc
+	methodNotAllowed http.HandlerFunc
+	cleanPath        bool
+	trailingSlash    bool
 }
 
 // The NewRouter creates a new instance of the router
-// struct. It initializes the rules field with an
-// empty map using make. It returns a pointer to
-// the created router.
+// struct with an empty routing table and the default
+// error handlers. It returns a pointer to the created
+// router.
 func NewRouter() *router {
-	return &router{
-		rules: make(map[string]map[string]http.HandlerFunc),
+	rt := &router{
+		notFound:         ErrorHandler(http.StatusNotFound),
+		methodNotAllowed: ErrorHandler(http.StatusMethodNotAllowed),
 	}
+	rt.table.Store(newRoutingTable())
+	return rt
 }
 
 // The findHandler method of the router is used to
 // find the appropriate handler function for a
-// given HTTP method and URL path. It takes the method
-// and path as parameters and returns the matching
-// http.HandlerFunc, along with boolean values
-// indicating whether the method and path exist in
-// the router's rules. It iterates through the rules
-// for the specified method, using regular expressions
-// to match the path against the stored routes.
-// If a match is found, it returns the corresponding
-// handler function and the boolean values.
-func (rt *router) findHandler(method, path string) (http.HandlerFunc, bool, bool) {
-	_, methodExists := rt.rules[method]
-	for route, handlerLogic := range rt.rules[method] {
-		if pathExists, _ := regexp.MatchString("^"+route+"$", path); pathExists {
-			return handlerLogic, methodExists, pathExists
-		}
-	}
-	return nil, methodExists, false
+// given HTTP method, host and URL path. The routes of the
+// first host pattern which matches the host are tried
+// first, then the default routes. It returns the matching
+// http.HandlerFunc and the captured path parameters. A
+// HEAD request is served by the GET handler when the path
+// has no HEAD handler of its own. When no handler is
+// found, it returns the methods allowed for the path in
+// both trees, which is empty if the path does not exist
+// at all.
+func (rt *router) findHandler(method, host, path string) (http.HandlerFunc, Params, []string) {
+	if !rt.started.Load() {
+		rt.start()
+	}
+	table := rt.table.Load()
+	parts := splitPath(path)
+	methods := make(map[string]bool)
+	hostParams := make(Params)
+	if root := table.hostRoot(host, hostParams); root != nil {
+		if found, ok := root.match(method, parts, hostParams); ok {
+			return found.handlerLogic, hostParams, nil
+		}
+		root.allowed(path, parts, methods)
+	}
+	params := make(Params)
+	if found, ok := table.root.match(method, parts, params); ok {
+		return found.handlerLogic, params, nil
+	}
+	table.root.allowed(path, parts, methods)
+	return nil, nil, allowedMethods(methods)
+}
+
+// The allowed method adds to methods the methods of the
+// routes of the tree for the path, or of all the routes
+// for the server wide OPTIONS * request.
+func (n *node) allowed(path string, parts []string, methods map[string]bool) {
+	if path == "*" {
+		n.walk(func(rte *Route) {
+			methods[rte.method] = true
+		})
+		return
+	}
+	n.collectMethods(parts, methods)
+}
+
+// The allowedMethods function returns the sorted list of
+// methods for the Allow header. Since HEAD is served from
+// GET and OPTIONS is answered by the router, both are
+// added whenever the path exists.
+func allowedMethods(methods map[string]bool) []string {
+	delete(methods, anyMethod)
+	if len(methods) == 0 {
+		return nil
+	}
+	if methods[http.MethodGet] {
+		methods[http.MethodHead] = true
+	}
+	methods[http.MethodOptions] = true
+	allowed := make([]string, 0, len(methods))
+	for method := range methods {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return allowed
 }
 
 // The ServeHTTP method of the router is the implementation
 // of the http.Handler interface. It receives an incoming
 // HTTP request and determines the appropriate handler
-// function using FindHandler. If the method or path does
-// not exist, it returns the corresponding HTTP status code.
-// Otherwise, it calls the obtained handlerFunc,
-// passing the response writer and request objects.
+// function using findHandler. If a handler is found, it
+// calls it, passing the response writer and the request,
+// whose context carries the path parameters available
+// with GetParams. Otherwise it answers:
+//
+//   - with a permanent redirection when the path is not
+//     registered, but its canonical form is (see
+//     canonicalPath),
+//   - with the not found handler when the path is not
+//     registered for any method,
+//   - 204 No Content with the Allow header to an OPTIONS
+//     request for a registered path,
+//   - with the method not allowed handler, after setting
+//     the Allow header, when the path is registered only
+//     for other methods.
 func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	handlerLogic, methodExists, pathExists := rt.findHandler(r.Method, r.URL.Path)
-	if !methodExists {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	handlerLogic, params, allowed := rt.findHandler(r.Method, requestHost(r), r.URL.Path)
+	if handlerLogic != nil {
+		handlerLogic(w, withParams(r, params))
+		return
+	}
+	if len(allowed) == 0 {
+		if canonical, ok := rt.canonicalPath(r); ok {
+			rt.redirect(w, r, canonical)
+			return
+		}
+		rt.notFound(w, r)
 		return
 	}
-	if !pathExists {
-		w.WriteHeader(http.StatusNotFound)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	handlerLogic(w, r)
+	rt.methodNotAllowed(w, r)
 }
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The namedHandler function returns a handler which
+// answers with the name, to tell which route matched.
+func namedHandler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, name)
+	}
+}
+
+// The serve function sends a request to the router and
+// returns the recorded answer.
+func serve(rt *router, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestRouterPriority(t *testing.T) {
+	rt := NewRouter()
+	for _, pattern := range []string{
+		"/customer/new",
+		"/customer/{id:int}",
+		"/customer/{uid:uuid}",
+		"/customer/{slug}",
+		"/customer/{rest:*}",
+		"/files/{name}/raw",
+		"/files/{path:*}",
+		"/orders/{id:int}/items",
+		"/orders/{slug}/summary",
+	} {
+		if _, err := rt.addRoute(nil, "", http.MethodGet, pattern, namedHandler(pattern), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		// Static wins over the parameters.
+		{"/customer/new", "/customer/new"},
+		// int wins over uuid and string.
+		{"/customer/42", "/customer/{id:int}"},
+		// uuid wins over string.
+		{"/customer/123e4567-e89b-12d3-a456-426614174000", "/customer/{uid:uuid}"},
+		{"/customer/alice", "/customer/{slug}"},
+		// A parameter wins over the wildcard.
+		{"/customer/alice/orders", "/customer/{rest:*}"},
+		{"/files/a/raw", "/files/{name}/raw"},
+		{"/files/a/b/raw", "/files/{path:*}"},
+		{"/files/a", "/files/{path:*}"},
+		// The router backtracks when the more specific
+		// branch does not lead to a route.
+		{"/orders/7/summary", "/orders/{slug}/summary"},
+		{"/orders/7/items", "/orders/{id:int}/items"},
+	}
+	for _, test := range tests {
+		w := serve(rt, http.MethodGet, test.path)
+		if w.Code != http.StatusOK || w.Body.String() != test.want {
+			t.Errorf("GET %s matched %d %q, want %q", test.path, w.Code, w.Body.String(), test.want)
+		}
+	}
+}
+
+func TestRouterParams(t *testing.T) {
+	rt := NewRouter()
+	var params Params
+	_, err := rt.addRoute(nil, "", http.MethodGet, "/customer/{id:int}/orders/{orderID:uuid}/{rest:*}",
+		func(w http.ResponseWriter, r *http.Request) { params = GetParams(r) }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(rt, http.MethodGet, "/customer/7/orders/123E4567-E89B-12D3-A456-426614174000/a/b")
+	want := Params{"id": 7, "orderID": "123e4567-e89b-12d3-a456-426614174000", "rest": "a/b"}
+	if fmt.Sprint(params) != fmt.Sprint(want) {
+		t.Errorf("the parameters are %v, want %v", params, want)
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	rt := NewRouter()
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		if _, err := rt.addRoute(nil, "", method, "/customer/{id:int}", namedHandler(method), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{http.MethodGet, "/customer/1", http.StatusOK, ""},
+		{http.MethodHead, "/customer/1", http.StatusOK, ""},
+		{http.MethodDelete, "/customer/1", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, PUT"},
+		{http.MethodOptions, "/customer/1", http.StatusNoContent, "GET, HEAD, OPTIONS, PUT"},
+		{http.MethodGet, "/customer/alice", http.StatusNotFound, ""},
+		{http.MethodGet, "/customer/1/", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := serve(rt, test.method, test.path)
+		if w.Code != test.status || w.Header().Get("Allow") != test.allow {
+			t.Errorf("%s %s answered %d with Allow %q, want %d with %q",
+				test.method, test.path, w.Code, w.Header().Get("Allow"), test.status, test.allow)
+		}
+	}
+}
+
+func TestRouterConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+	}{
+		{"same route", []string{"/customer/{id:int}", "/customer/{id:int}"}},
+		{"same type, other name", []string{"/customer/{id:int}", "/customer/{number:int}/orders"}},
+		{"wildcards with other names", []string{"/files/{path:*}", "/files/{rest:*}"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := NewRouter()
+			if _, err := rt.addRoute(nil, "", http.MethodGet, test.patterns[0], noopHandler, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rt.addRoute(nil, "", http.MethodGet, test.patterns[1], noopHandler, nil); err == nil {
+				t.Errorf("adding %s after %s returned no error", test.patterns[1], test.patterns[0])
+			}
+		})
+	}
+}
+
+// The benchmarkRouter function registers size routes like
+// the ones of a REST API and measures the lookup of the
+// last one, whose cost must not grow with the size.
+func benchmarkRouter(b *testing.B, size int) {
+	rt := NewRouter()
+	for index := range size {
+		patterns := []string{
+			fmt.Sprintf("/api/v1/resource%d", index),
+			fmt.Sprintf("/api/v1/resource%d/{id:int}", index),
+			fmt.Sprintf("/api/v1/resource%d/{id:int}/items/{itemID:uuid}", index),
+		}
+		for _, pattern := range patterns[:1+index%3] {
+			if _, err := rt.addRoute(nil, "", http.MethodGet, pattern, noopHandler, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	// The resources whose index is 1 or 2 modulo 3 have the
+	// routes with one and two parameters.
+	last := size - 1
+	base := last - last%3 - 3
+	paths := []string{
+		fmt.Sprintf("/api/v1/resource%d", last),
+		fmt.Sprintf("/api/v1/resource%d/42", base+1),
+		fmt.Sprintf("/api/v1/resource%d/42/items/123e4567-e89b-12d3-a456-426614174000", base+2),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for index := range b.N {
+		path := paths[index%len(paths)]
+		if handlerLogic, _, _ := rt.findHandler(http.MethodGet, "", path); handlerLogic == nil {
+			b.Fatalf("GET %s did not match", path)
+		}
+	}
+}
+
+func BenchmarkRouter10(b *testing.B)   { benchmarkRouter(b, 10) }
+func BenchmarkRouter100(b *testing.B)  { benchmarkRouter(b, 100) }
+func BenchmarkRouter1000(b *testing.B) { benchmarkRouter(b, 1000) }
+
+func TestRouterSnapshots(t *testing.T) {
+	rt := NewRouter()
+	rt.start()
+	kept, err := rt.addRoute(nil, "", http.MethodGet, "/customer/{id:int}", namedHandler("get"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := rt.table.Load()
+	if _, err := rt.addRoute(nil, "", http.MethodPut, "/customer/{id:int}", namedHandler("put"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.addRoute(nil, "", http.MethodGet, "/customer/{id:int}/orders", namedHandler("orders"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.nameRoute(kept, "customer"); err != nil {
+		t.Fatal(err)
+	}
+	kept.Remove()
+
+	// The table published before the changes is a
+	// snapshot, the changes were made on copies.
+	snapshot := NewRouter()
+	snapshot.table.Store(before)
+	for _, test := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/customer/1", http.StatusOK},
+		{http.MethodPut, "/customer/1", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/customer/1/orders", http.StatusNotFound},
+	} {
+		if w := serve(snapshot, test.method, test.path); w.Code != test.status {
+			t.Errorf("the snapshot answered %s %s with %d, want %d", test.method, test.path, w.Code, test.status)
+		}
+	}
+	if len(before.names) != 0 {
+		t.Errorf("the snapshot sees the names %v given later", before.names)
+	}
+
+	if w := serve(rt, http.MethodGet, "/customer/1"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET of the removed route answered %d, want 405", w.Code)
+	}
+	for _, test := range []struct{ method, path, want string }{
+		{http.MethodPut, "/customer/1", "put"},
+		{http.MethodGet, "/customer/1/orders", "orders"},
+	} {
+		if w := serve(rt, test.method, test.path); w.Body.String() != test.want {
+			t.Errorf("%s %s answered %q, want %q", test.method, test.path, w.Body.String(), test.want)
+		}
+	}
+}
+
+func TestRouterDraft(t *testing.T) {
+	rt := NewRouter()
+	if _, err := rt.addRoute(nil, "", http.MethodGet, "/customer/{id:int}", namedHandler("get"), nil); err != nil {
+		t.Fatal(err)
+	}
+	draft := rt.table.Load()
+	if _, err := rt.addRoute(nil, "", http.MethodGet, "/customer/{id:uuid}", noopHandler, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.addRoute(nil, "", http.MethodGet, "/customer/{name}", noopHandler, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.addRoute(nil, "", http.MethodGet, "/customer/{slug}", noopHandler, nil); err == nil {
+		t.Error("adding a conflicting route to the draft returned no error")
+	}
+	if rt.table.Load() != draft {
+		t.Error("the changes before the first request copied the table")
+	}
+
+	// The first request starts the router, so the next
+	// changes are made on copies again.
+	if w := serve(rt, http.MethodGet, "/customer/1"); w.Body.String() != "get" {
+		t.Errorf("GET /customer/1 answered %q, want %q", w.Body.String(), "get")
+	}
+	if _, err := rt.addRoute(nil, "", http.MethodPut, "/customer/{id:int}", noopHandler, nil); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(rt, http.MethodPut, "/customer/1"); w.Code != http.StatusOK {
+		t.Errorf("PUT /customer/1 answered %d, want 200", w.Code)
+	}
+	snapshot := NewRouter()
+	snapshot.table.Store(draft)
+	if w := serve(snapshot, http.MethodPut, "/customer/1"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("a change after the first request modified the published table, PUT answered %d", w.Code)
+	}
+}
+
+// The benchmarkRegister function measures the
+// registration of size routes, before the router serves
+// requests or while it serves them, whose cost must grow
+// linearly with the size before.
+func benchmarkRegister(b *testing.B, size int, started bool) {
+	b.ReportAllocs()
+	for range b.N {
+		rt := NewRouter()
+		if started {
+			rt.start()
+		}
+		for index := range size {
+			if _, err := rt.addRoute(nil, "", http.MethodGet, fmt.Sprintf("/api/v1/resource%d/{id:int}", index), noopHandler, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkRegister100(b *testing.B)         { benchmarkRegister(b, 100, false) }
+func BenchmarkRegister1000(b *testing.B)        { benchmarkRegister(b, 1000, false) }
+func BenchmarkRegisterStarted1000(b *testing.B) { benchmarkRegister(b, 1000, true) }
+
+// The noopHandler function is the handler of the routes
+// whose answer does not matter.
+func noopHandler(w http.ResponseWriter, r *http.Request) {}
@@ -1,9 +1,17 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"io/fs"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/MetalbolicX/vanilla-go-webserver/internal/db"
 	"github.com/MetalbolicX/vanilla-go-webserver/pkg/repository"
@@ -11,59 +19,217 @@ import (
 )
 
 // The Server struct represents the server configuration.
-// It has fields for the listening port, a router instance
+// It has fields for the listening port, a router instance,
+// the global middlewares added with Use and its own
+// http.Server, so several servers can run in the same
+// process without sharing the default mux.
 type Server struct {
-	port   string
-	router *router
+	port               string
+	router             *router
+	middlewares        []types.Middleware
+	httpServer         *http.Server
+	maxConnections     int
+	shutdownTimeout    time.Duration
+	shutdownHooks      []ShutdownHook
+	tls                tlsSettings
+	redirectServer     *http.Server
+	internalError      http.HandlerFunc
+	panicReporter      PanicReporter
+	livenessPath       string
+	readinessPath      string
+	healthChecks       []healthCheck
+	healthCheckTimeout time.Duration
+	drainDelay         time.Duration
+	shuttingDown       atomic.Bool
+	socketMode         fs.FileMode
+	listener           net.Listener
+	redirectListener   net.Listener
+	proxyTrusted       []netip.Prefix
+	preforkWorkers     int
+	preforkStatusAddr  string
+	prefork            preforkState
+	staticGzipMinSize  int
+	shutdownOnce       sync.Once
+	shutdownDone       chan struct{}
+	shutdownErr        error
+	h2c                *h2cUpgrader
 }
 
 // The NewServer function creates a new instance of
-// the Server. It takes the port as parameters and initializes
-// the server with the provided values.
-// It also creates a new router
-// using the NewRouter function.
-func NewServer(port string) *Server {
-	return &Server{
-		port:   port,
-		router: NewRouter(),
+// the Server. It takes the port and the options as
+// parameters and initializes the server with the provided
+// values. The port is a TCP address like :3000 or a Unix
+// domain socket path like unix:/run/app.sock. The
+// timeouts which are not set by an option take safe
+// default values. It also creates a new router using the
+// NewRouter function.
+func NewServer(port string, options ...Option) *Server {
+	s := &Server{
+		port:               port,
+		router:             NewRouter(),
+		shutdownTimeout:    defaultShutdownTimeout,
+		internalError:      ErrorHandler(http.StatusInternalServerError),
+		livenessPath:       defaultLivenessPath,
+		readinessPath:      defaultReadinessPath,
+		healthCheckTimeout: defaultHealthCheckTimeout,
+		socketMode:         defaultSocketMode,
+		staticGzipMinSize:  defaultStaticGzipMinSize,
+		shutdownDone:       make(chan struct{}),
+		tls: tlsSettings{
+			minVersion: tls.VersionTLS12,
+			hstsMaxAge: defaultHSTSMaxAge,
+		},
+		httpServer: &http.Server{
+			Addr:              port,
+			ReadHeaderTimeout: defaultReadHeaderTimeout,
+			ReadTimeout:       defaultReadTimeout,
+			WriteTimeout:      defaultWriteTimeout,
+			IdleTimeout:       defaultIdleTimeout,
+			MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+			// The router answers OPTIONS * with the methods
+			// of all the routes.
+			DisableGeneralOptionsHandler: true,
+		},
 	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
 }
 
 // The String method provides a string representation
 // of the server, indicating the selected port for
 // listening.
 func (s *Server) String() string {
+	if s.isTLS() {
+		return fmt.Sprintf("Port listening selected is %s (HTTPS)", s.port)
+	}
 	return fmt.Sprintf("Port listening selected is %s", s.port)
 }
 
 // The Handle method allows you to define a routing rule
 // for the server. It takes an HTTP method, URL path
-// and a handler function. It checks if the method
-// already exists in the router's rules. If not,
-// it creates a new map to store the rules for that method.
-// It then assigns the provided handler function to
-// the specified method and path.
-func (s *Server) Handle(method, path string, handlerLogic http.HandlerFunc) {
-	if _, methodExists := s.router.rules[method]; !methodExists {
-		s.router.rules[method] = make(map[string]http.HandlerFunc)
+// pattern and a handler function. The pattern can declare
+// named and typed parameters with the {name:type} syntax,
+// for example /customer/{id:int}/orders/{orderID:uuid}.
+// The supported types are string (the default when the
+// type is omitted), int, uuid and * (a wildcard that
+// captures the rest of the path). The captured values are
+// available in the handler through GetParams. When several
+// patterns match a path, static segments win over
+// parameters and parameters over wildcards. Handle
+// panics if the pattern is not valid or is ambiguous with
+// a route already registered: the same method and pattern,
+// or a parameter of the same type with a different name in
+// the same position. So the mistake is found when the
+// server starts. It returns the route, which can be named
+// to build its URL with URLFor. Handle is safe for
+// concurrent use, so routes can be added, and removed with
+// Route.Remove, while the server is running. Until the
+// server answers its first request the routes are added
+// in place, so registering many routes at start up costs
+// as much as the routes; later every change copies the
+// path of its route (see Batch).
+func (s *Server) Handle(method, path string, handlerLogic http.HandlerFunc) *Route {
+	return s.handle(nil, "", method, path, handlerLogic, nil)
+}
+
+// The handle method registers the route of the host
+// (empty for the default routes) wrapped by the
+// middlewares, in the batch if one is given, and panics
+// if it cannot be added.
+func (s *Server) handle(batch *routeBatch, host, method, path string, handlerLogic http.HandlerFunc, middlewares []types.Middleware) *Route {
+	rte, err := s.router.addRoute(batch, host, method, path, handlerLogic, middlewares)
+	if err != nil {
+		panic(err)
 	}
-	s.router.rules[method][path] = handlerLogic
+	return rte
+}
+
+// The URLFor method builds the URL path of the route
+// called name, replacing the parameters of its pattern
+// with params, given as key and value pairs. For example,
+// with the route /customer/{id:int} named "customer",
+// URLFor("customer", "id", 1) returns /customer/1. It
+// returns an error if the route does not exist or the
+// parameters do not fit its pattern. The method has the
+// signature of a template function, so it can be added
+// to the templates with render.AddFunction.
+func (s *Server) URLFor(name string, params ...any) (string, error) {
+	return s.router.urlFor(name, params...)
 }
 
 // The Listen method starts the server and listens for
-// incoming requests. I It registers the router with the
-// root path ("/") as the default handler for all requests.
-// Finally, it starts the server by calling
-// http.ListenAndServe with the specified port
-// and it logs the server's listening port.
+// incoming requests until the process receives SIGINT or
+// SIGTERM. Then it shuts the server down gracefully. It
+// is a shortcut of Run with a background context.
 func (s *Server) Listen() error {
-	http.Handle("/", s.router)
-	log.Println(s.String())
-	if err := http.ListenAndServe(s.port, nil); err != nil {
-		return err
+	return s.Run(context.Background())
+}
+
+// The listen method opens the listener of the server
+// address (see openListener), which reads the PROXY
+// protocol headers of the trusted networks, if any, and is
+// limited to the maximum number of connections if one was
+// set.
+func (s *Server) listen() (net.Listener, error) {
+	listener, err := s.openListener()
+	if err != nil {
+		return nil, err
 	}
+	s.listener = listener
+	if len(s.proxyTrusted) > 0 {
+		listener = newProxyListener(listener, s.proxyTrusted, s.httpServer.ReadHeaderTimeout)
+	}
+	if s.maxConnections > 0 {
+		listener = newLimitListener(listener, s.maxConnections)
+	}
+	return listener, nil
+}
 
-	return nil
+// The Use method adds global middlewares, which wrap the
+// whole handler tree of the server: the routes, the
+// static files and the handlers mounted with Mount. It
+// can be called several times and must be
+// called before Listen. A request goes through the
+// middlewares in this order:
+//
+//  1. the global middlewares, in the order they were
+//     added with Use,
+//  2. the middlewares of the route groups, from the
+//     outermost group to the innermost one,
+//  3. the middlewares applied to the handler with
+//     AddMiddleware, and finally the handler.
+//
+// The global middlewares run before the route is matched,
+// so GetParams returns no parameters in them.
+func (s *Server) Use(middlewares ...types.Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// The Handler method returns the root http.Handler of the
+// server, the router wrapped by the global middlewares.
+// It is the handler Listen serves. When the server uses
+// HTTPS, the Strict-Transport-Security header is added
+// before the global middlewares run. The internal error
+// handler is stored in the request context first, so
+// InternalError works in the middlewares too, and then
+// the panics of the middlewares and the handlers are
+// recovered and answered with it. The liveness and
+// readiness endpoints are answered before the global
+// middlewares. With WithH2C, the requests which ask for
+// the upgrade to h2c are upgraded before all of that, and
+// then their connection is served by the same handler.
+func (s *Server) Handler() http.Handler {
+	handlerLogic := chainMiddlewares(s.router.ServeHTTP, s.middlewares)
+	if s.isTLS() && s.tls.hstsMaxAge > 0 {
+		handlerLogic = hsts(s.tls.hstsMaxAge)(handlerLogic)
+	}
+	handler := http.Handler(s.withInternalError(s.recoverer(s.withHealth(handlerLogic))))
+	if s.h2c != nil && !s.isTLS() {
+		handler = s.h2c.wrap(handler)
+	}
+	return handler
 }
 
 // The SetDBConfig set the configuration to connect
@@ -72,13 +238,19 @@ func (s *Server) Listen() error {
 // connection string as parameters. It creates a new repository using
 // the provided parameters and sets it as the
 // implementation for the repository using repository.
-// SetRepository.
+// SetRepository. The database is pinged by the readiness
+// check and the connection is closed when the server
+// shuts down.
 func (s *Server) SetDBConfig(dbManagmentSystem, dbUrl string) error {
 	repo, err := db.NewRelationalDBRepo(dbManagmentSystem, dbUrl)
 	if err != nil {
 		return err
 	}
 	repository.SetRepository(repo)
+	s.AddHealthCheck("database", repository.Ping)
+	s.OnShutdown(func(ctx context.Context) error {
+		return repository.Close()
+	})
 
 	return nil
 }
@@ -87,13 +259,29 @@ func (s *Server) SetDBConfig(dbManagmentSystem, dbUrl string) error {
 // server to serve static files if a static folder is
 // specified. It creates a file server using
 // http.FileServer with the provided static folder path.
-// It then registers a handler for the folder path,
-// stripping the folder prefix from the URL path
-// before serving the static files.
+// It then registers it in the router for the GET method
+// under the folder prefix, stripping the prefix from the
+// URL path before serving the static files. The route is
+// named "static", so the templates can build the URL of
+// a file with {{urlFor "static" "filepath" "css/styles.css"}}.
 func (s *Server) SetupStaticFileServer(staticFolderPath, prefixToStrip string) {
-	fileServer := http.FileServer(http.Dir(staticFolderPath))
+	s.SetupStaticFS(os.DirFS(staticFolderPath), prefixToStrip)
+}
+
+// The SetupStaticFS method works like
+// SetupStaticFileServer, but serves the files of fsys,
+// e.g. the static folder embedded in the binary with an
+// embed.FS and fs.Sub, so the server does not depend on
+// the directory where it starts. The files are sent
+// compressed when the client accepts it: the .br or .gz
+// copy next to a file is preferred (see GzipStaticFiles),
+// and otherwise the text files are compressed with gzip
+// on the fly (see WithStaticGzipMinSize).
+func (s *Server) SetupStaticFS(fsys fs.FS, prefixToStrip string) {
+	fileServer := newStaticHandler(fsys, s.staticGzipMinSize)
 	prefix := fmt.Sprintf("/%s/", prefixToStrip)
-	http.Handle(prefix, http.StripPrefix(prefix, fileServer))
+	s.Handle(http.MethodGet, prefix+"{filepath:*}",
+		http.StripPrefix(prefix, fileServer).ServeHTTP).Name("static")
 }
 
 // The function applies the provided middlewares to the
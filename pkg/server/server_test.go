@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	static := t.TempDir()
+	if err := os.WriteFile(filepath.Join(static, "styles.css"), []byte("body {}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("127.0.0.1:0")
+	s.Use(traceMiddleware("global"))
+	s.Use(traceMiddleware("global2"))
+	s.Group("/api", traceMiddleware("group")).Handle(http.MethodGet, "/customer",
+		s.AddMiddleware(namedHandler("customer"), traceMiddleware("handler")))
+	s.SetupStaticFileServer(static, "resources")
+	handler := s.Handler()
+
+	tests := []struct {
+		path   string
+		status int
+		trace  string
+	}{
+		// The global middlewares run first, in the order of
+		// Use, then the group and the handler ones.
+		{"/api/customer", http.StatusOK, "global,global2,group,handler"},
+		// They wrap the static files and the error answers
+		// too.
+		{"/resources/styles.css", http.StatusOK, "global,global2"},
+		{"/missing", http.StatusNotFound, "global,global2"},
+		// The health checks are answered before them.
+		{"/healthz", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("GET %s answered %d, want %d", test.path, w.Code, test.status)
+		}
+		if trace := strings.Join(w.Header().Values("X-Trace"), ","); trace != test.trace {
+			t.Errorf("GET %s ran the middlewares %q, want %q", test.path, trace, test.trace)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// The ShutdownHook is a function executed when the server
+// shuts down, after the requests in progress finish. It
+// releases a resource, e.g. closes the database, flushes
+// the logs or stops a worker, before the deadline of ctx.
+type ShutdownHook func(ctx context.Context) error
+
+// The OnShutdown method registers hooks to run when the
+// server shuts down. The hooks run in the reverse order of
+// registration, like deferred calls, so a resource
+// registered first (e.g., the database) is released after
+// the ones which may still use it.
+func (s *Server) OnShutdown(hooks ...ShutdownHook) {
+	s.shutdownHooks = append(s.shutdownHooks, hooks...)
+}
+
+// The Run method starts the server and serves the incoming
+// requests until ctx is canceled or the process receives
+// SIGINT or SIGTERM. On SIGUSR2 it starts the executable
+// again, e.g. a new version, hands it the listening
+// sockets and stops once the new process is serving, so
+// no connection is refused during the restart (see
+// handoff). Then it stops accepting connections,
+// waits for the requests in progress and runs the shutdown
+// hooks, all within the shutdown timeout. It returns nil
+// after a clean shutdown and an error if the server could
+// not start, failed while serving or did not shut down
+// cleanly, so the caller can exit with a failure status.
+// When Shutdown is called directly, Run returns its result
+// once it finishes, so the caller does not exit while the
+// hooks are running. In prefork mode Run supervises the
+// workers instead (see WithPrefork).
+func (s *Server) Run(ctx context.Context) error {
+	if s.preforkWorkers > 0 && !isPreforkWorker() {
+		return s.supervise(ctx)
+	}
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s.httpServer.Handler = s.Handler()
+	if s.isTLS() {
+		tlsConfig, err := s.buildTLSConfig()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		s.httpServer.TLSConfig = tlsConfig
+		if s.tls.redirectAddr != "" {
+			s.redirectServer = s.newRedirectServer()
+		}
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		if s.isTLS() {
+			// The certificate is in the TLSConfig, so no
+			// files are given.
+			serveErr <- s.httpServer.ServeTLS(listener, "", "")
+			return
+		}
+		serveErr <- s.httpServer.Serve(listener)
+	}()
+	s.startRedirectServer(serveErr)
+	log.Println(s.String())
+	if err := notifyReady(); err != nil {
+		log.Println("Cannot notify the previous process: ", err)
+	}
+
+	restart := make(chan os.Signal, 1)
+	if len(handoffSignals) > 0 {
+		signal.Notify(restart, handoffSignals...)
+		defer signal.Stop(restart)
+	}
+	for waiting := true; waiting; {
+		select {
+		case err := <-serveErr:
+			if errors.Is(err, http.ErrServerClosed) {
+				// Shutdown was called directly, wait until it
+				// drains the requests and runs the hooks.
+				<-s.shutdownDone
+				return s.shutdownErr
+			}
+			return errors.Join(err, s.Shutdown(context.Background()))
+		case <-restart:
+			log.Println("Starting a new process of the server")
+			if err := s.handoff(); err != nil {
+				log.Println("Restart failed, the server keeps serving: ", err)
+				continue
+			}
+			waiting = false
+		case <-ctx.Done():
+			waiting = false
+		}
+	}
+	// Restore the default behavior of the signals, so a
+	// second signal kills the process without waiting.
+	stop()
+	log.Println("Shutting down the server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// The Shutdown method stops the server gracefully: it
+// makes the readiness check fail and waits for the drain
+// delay, if one is set, then it closes the listener,
+// waits for the requests in progress until the deadline
+// of ctx and then runs the shutdown hooks. If the
+// requests do not finish in time, their connections are
+// closed. It returns the errors of the draining and of
+// the hooks. The server shuts down once: the next calls
+// wait for the first one and return its result, and so
+// does Run.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+		close(s.shutdownDone)
+	})
+	return s.shutdownErr
+}
+
+// The shutdown method does the work of Shutdown.
+func (s *Server) shutdown(ctx context.Context) error {
+	s.drain(ctx)
+	var drainErr error
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.httpServer.Close()
+		drainErr = fmt.Errorf("waiting for the requests in progress: %w", err)
+	}
+	if s.h2c != nil {
+		if err := s.h2c.drain(ctx); err != nil {
+			drainErr = errors.Join(drainErr, fmt.Errorf("waiting for the h2c connections: %w", err))
+		}
+	}
+	redirectErr := s.shutdownRedirectServer(ctx)
+	return errors.Join(drainErr, redirectErr, s.runShutdownHooks(ctx))
+}
+
+// The runShutdownHooks method executes the shutdown hooks
+// in reverse order of registration. A failing hook does
+// not stop the next ones and all the errors are returned.
+func (s *Server) runShutdownHooks(ctx context.Context) error {
+	errs := make([]error, 0)
+	for index := len(s.shutdownHooks) - 1; index >= 0; index-- {
+		if err := s.shutdownHooks[index](ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
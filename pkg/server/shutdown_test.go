@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWaitsForShutdown(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	var hookDone atomic.Bool
+	hookErr := errors.New("hook failed")
+	s.OnShutdown(func(ctx context.Context) error {
+		time.Sleep(100 * time.Millisecond)
+		hookDone.Store(true)
+		return hookErr
+	})
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	shutdownErr := s.Shutdown(context.Background())
+	if !errors.Is(shutdownErr, hookErr) {
+		t.Errorf("Shutdown returned %v, want the error of the hook", shutdownErr)
+	}
+	select {
+	case err := <-runErr:
+		if !hookDone.Load() {
+			t.Error("Run returned before the shutdown hook finished")
+		}
+		if !errors.Is(err, hookErr) {
+			t.Errorf("Run returned %v, want the error of the hook", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Shutdown")
+	}
+	if err := s.Shutdown(context.Background()); !errors.Is(err, hookErr) {
+		t.Errorf("a second Shutdown returned %v, want the result of the first one", err)
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unixPrefix is the prefix of the server addresses which
+// are Unix domain socket paths, e.g. unix:/run/app.sock.
+const unixPrefix = "unix:"
+
+// defaultSocketMode is the permission of the Unix domain
+// socket, read and write for the owner and the group, so
+// a reverse proxy in the group can connect.
+const defaultSocketMode fs.FileMode = 0o660
+
+// listenFDsStart is the first file descriptor passed by
+// systemd with the socket activation, after stdin, stdout
+// and stderr.
+const listenFDsStart = 3
+
+// WithSocketMode sets the permissions of the Unix domain
+// socket, 0660 by default.
+func WithSocketMode(mode fs.FileMode) Option {
+	return func(s *Server) {
+		s.socketMode = mode
+	}
+}
+
+// The openListener method opens the listener of the
+// server address: the socket passed by the previous
+// process in a handoff, the shared TCP socket of a
+// prefork worker, the socket inherited from systemd when
+// the process is socket activated, the Unix domain socket
+// for the addresses with the unix: prefix or otherwise a
+// TCP socket.
+func (s *Server) openListener() (net.Listener, error) {
+	if listener := takeInherited(serverListenerName); listener != nil {
+		return listener, nil
+	}
+	if isPreforkWorker() {
+		return listenReusePort(s.port)
+	}
+	listener, err := activatedListener()
+	if listener != nil || err != nil {
+		return listener, err
+	}
+	if path, isUnix := strings.CutPrefix(s.port, unixPrefix); isUnix {
+		return listenUnix(path, s.socketMode)
+	}
+	return net.Listen("tcp", s.port)
+}
+
+// The activatedListener function returns the listener
+// passed by systemd with the socket activation, described
+// by the LISTEN_PID and LISTEN_FDS variables, or nil if
+// the process was not socket activated. The variables are
+// removed, so the child processes do not use the socket
+// too. Only the first socket is used.
+func activatedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("LISTEN_FDS: invalid number of sockets %q", os.Getenv("LISTEN_FDS"))
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if count > 1 {
+		log.Printf("Socket activation passed %d sockets, only the first one is used", count)
+	}
+	file := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_3")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	return listener, nil
+}
+
+// The listenUnix function listens on the Unix domain
+// socket path with the permissions mode. A socket file
+// left by a server which did not stop cleanly is removed
+// first, but not a socket where another server is still
+// listening, nor a file which is not a socket. The socket
+// file is removed when the listener is closed.
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("socket %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// The removeStaleSocket function removes the socket file
+// of the path if nothing answers on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("socket %s: the file exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s: another server is listening on it", path)
+	}
+	return os.Remove(path)
+}
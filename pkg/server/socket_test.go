@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows":
+		t.Skip("the socket permissions are not supported on Windows")
+	case "plan9":
+		t.Skip("the Unix sockets are not supported on plan9")
+	}
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.sock")
+	listener, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The socket file stays, like after a crash. The method
+	// is missing on plan9, which has no Unix sockets.
+	listener.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	listener.Close()
+	active := filepath.Join(dir, "active.sock")
+	listener, err = net.Listen("unix", active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	regular := filepath.Join(dir, "regular.sock")
+	if err := os.WriteFile(regular, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		mode    fs.FileMode
+		failure bool
+	}{
+		{"new", filepath.Join(dir, "new.sock"), 0o600, false},
+		{"stale", stale, defaultSocketMode, false},
+		{"active", active, defaultSocketMode, true},
+		{"not a socket", regular, defaultSocketMode, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listener, err := listenUnix(test.path, test.mode)
+			if test.failure {
+				if err == nil {
+					listener.Close()
+					t.Fatalf("listenUnix(%s) returned no error", test.path)
+				}
+				if _, err := os.Lstat(test.path); err != nil {
+					t.Errorf("the failed listenUnix removed %s", test.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != test.mode {
+				t.Errorf("the socket has the permissions %v, want %v", info.Mode().Perm(), test.mode)
+			}
+			conn, err := net.Dial("unix", test.path)
+			if err != nil {
+				t.Fatalf("dialing the socket: %v", err)
+			}
+			conn.Close()
+			listener.Close()
+			if _, err := os.Lstat(test.path); err == nil {
+				t.Error("the socket file was not removed when the listener was closed")
+			}
+		})
+	}
+}
+
+func TestOpenUnixListener(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows":
+		t.Skip("the socket permissions are not supported on Windows")
+	case "plan9":
+		t.Skip("the Unix sockets are not supported on plan9")
+	}
+	path := filepath.Join(t.TempDir(), "server.sock")
+	for _, test := range []struct {
+		options []Option
+		mode    fs.FileMode
+	}{
+		{nil, defaultSocketMode},
+		{[]Option{WithSocketMode(0o666)}, 0o666},
+	} {
+		listener, err := NewServer(unixPrefix+path, test.options...).openListener()
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		listener.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != test.mode {
+			t.Errorf("the socket has the permissions %v, want %v", info.Mode().Perm(), test.mode)
+		}
+	}
+}
+
+func TestActivatedListenerEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		pid, fds    string
+		activated   bool
+		wantFailure bool
+	}{
+		{"not activated", "", "", false, false},
+		{"other process", strconv.Itoa(os.Getpid() + 1), "1", false, false},
+		{"no sockets", strconv.Itoa(os.Getpid()), "0", false, true},
+		{"invalid count", strconv.Itoa(os.Getpid()), "many", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", test.pid)
+			t.Setenv("LISTEN_FDS", test.fds)
+			listener, err := activatedListener()
+			if (err != nil) != test.wantFailure || (listener != nil) != test.activated {
+				t.Errorf("activatedListener returned (%v, %v)", listener, err)
+			}
+		})
+	}
+}
+
+// The TestActivatedListener test runs the test binary
+// again with a TCP socket as file descriptor 3 and the
+// systemd variables, like a socket activated service.
+func TestActivatedListener(t *testing.T) {
+	if os.Getenv("TEST_SOCKET_ACTIVATION") == "1" {
+		socketActivatedChild(t)
+		return
+	}
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("the file descriptors cannot be inherited on " + runtime.GOOS)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := listener.(*net.TCPListener).File()
+	listener.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestActivatedListener$")
+	cmd.Env = append(os.Environ(), "TEST_SOCKET_ACTIVATION=1", "LISTEN_FDS=1", "LISTEN_FDNAMES=http")
+	cmd.ExtraFiles = []*os.File{file}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Only the child process keeps the socket open, so the
+	// connection fails if it does not listen.
+	file.Close()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	answer, _ := bufio.NewReader(conn).ReadString('\n')
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("the socket activated process failed: %v", err)
+	}
+	if answer != "activated\n" {
+		t.Errorf("the socket activated process answered %q", answer)
+	}
+}
+
+// The socketActivatedChild function is the socket
+// activated process of TestActivatedListener. systemd
+// sets LISTEN_PID to the pid of the service, which is
+// only known here.
+func socketActivatedChild(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	listener, err := activatedListener()
+	if err != nil || listener == nil {
+		t.Fatalf("activatedListener returned (%v, %v)", listener, err)
+	}
+	defer listener.Close()
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if value, exists := os.LookupEnv(key); exists {
+			t.Errorf("%s=%s was not removed from the environment", key, value)
+		}
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("activated\n"))
+}
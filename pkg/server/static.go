@@ -0,0 +1,354 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultStaticGzipMinSize is the size, in bytes, from
+// which the static files are compressed on the fly. The
+// smaller files do not save enough to pay the headers and
+// the CPU.
+const defaultStaticGzipMinSize = 1024
+
+// The precompressed encodings, in order of preference, and
+// the extension of the files compressed with them.
+var precompressedEncodings = []struct {
+	coding    string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// compressibleTypes are the media types, besides text/*,
+// which are worth compressing. The images, fonts and
+// archives are compressed already.
+var compressibleTypes = map[string]bool{
+	"application/javascript":    true,
+	"application/json":          true,
+	"application/manifest+json": true,
+	"application/wasm":          true,
+	"application/xml":           true,
+	"image/svg+xml":             true,
+}
+
+// gzipWriters reuses the gzip writers, which allocate a lot.
+var gzipWriters = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// WithStaticGzipMinSize sets the size, in bytes, from which
+// the static files of a compressible type (e.g. CSS,
+// JavaScript or SVG) are compressed with gzip on the fly
+// when the client accepts it, 1024 by default. A negative
+// size disables the compression on the fly, but the .br
+// and .gz files next to the static files are still used.
+func WithStaticGzipMinSize(size int) Option {
+	return func(s *Server) {
+		s.staticGzipMinSize = size
+	}
+}
+
+// The staticHandler serves the static files of a file
+// system, preferring the precompressed copies (e.g.
+// styles.css.br or styles.css.gz next to styles.css) when
+// the client accepts their encoding, and otherwise
+// compressing the files of a compressible type on the fly.
+// The directories and the files it cannot handle are left
+// to http.FileServerFS.
+type staticHandler struct {
+	fsys        fs.FS
+	fileServer  http.Handler
+	gzipMinSize int
+}
+
+// The newStaticHandler function returns the handler of the
+// static files of fsys.
+func newStaticHandler(fsys fs.FS, gzipMinSize int) *staticHandler {
+	return &staticHandler{fsys: fsys, fileServer: http.FileServerFS(fsys), gzipMinSize: gzipMinSize}
+}
+
+// The ServeHTTP method serves the file of the request
+// path. The responses of the files which have a compressed
+// form vary with the Accept-Encoding header, so the caches
+// keep one copy per encoding.
+func (sh *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	info, err := fs.Stat(sh.fsys, name)
+	// The file server redirects the index.html paths to
+	// their directory.
+	if err != nil || !info.Mode().IsRegular() || path.Base(name) == "index.html" {
+		sh.fileServer.ServeHTTP(w, r)
+		return
+	}
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	contentType := mime.TypeByExtension(path.Ext(name))
+
+	onTheFly := sh.gzipMinSize >= 0 && info.Size() >= int64(sh.gzipMinSize) && isCompressible(contentType)
+	varies := onTheFly
+	coding, compressedName := "", ""
+	for _, encoding := range precompressedEncodings {
+		// A copy older than the file is outdated, like for
+		// GzipStaticFiles.
+		compressedInfo, err := fs.Stat(sh.fsys, name+encoding.extension)
+		if err != nil || !compressedInfo.Mode().IsRegular() || compressedInfo.ModTime().Before(info.ModTime()) {
+			continue
+		}
+		varies = true
+		if coding == "" && acceptsEncoding(acceptEncoding, encoding.coding) {
+			coding, compressedName = encoding.coding, name+encoding.extension
+		}
+	}
+	if varies {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	if coding != "" && sh.serveCompressed(w, r, name, compressedName, coding, contentType) {
+		return
+	}
+	// A range of the compressed data would not be the
+	// range asked, so the ranges are served uncompressed.
+	if onTheFly && r.Header.Get("Range") == "" && acceptsEncoding(acceptEncoding, "gzip") {
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		sh.fileServer.ServeHTTP(gw, r)
+		return
+	}
+	sh.fileServer.ServeHTTP(w, r)
+}
+
+// The serveCompressed method serves the precompressed copy
+// of the file name with the content type of the original
+// file, sniffed from its content when the extension is not
+// known. It returns false, without writing anything, if
+// the copy cannot be served.
+func (sh *staticHandler) serveCompressed(w http.ResponseWriter, r *http.Request, name, compressedName, coding, contentType string) bool {
+	file, err := sh.fsys.Open(compressedName)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	content, isSeeker := file.(io.ReadSeeker)
+	info, err := file.Stat()
+	if !isSeeker || err != nil {
+		return false
+	}
+	if contentType == "" {
+		if contentType, err = sh.sniffContentType(name); err != nil {
+			return false
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", coding)
+	http.ServeContent(w, r, compressedName, info.ModTime(), content)
+	return true
+}
+
+// The sniffContentType method detects the content type of
+// the file name from its first bytes, like the file
+// server does.
+func (sh *staticHandler) sniffContentType(name string) (string, error) {
+	file, err := sh.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	start := make([]byte, 512)
+	n, err := io.ReadFull(file, start)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return http.DetectContentType(start[:n]), nil
+}
+
+// The isCompressible function reports whether the content
+// type is text or one of the compressibleTypes.
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+// The acceptsEncoding function reports whether the
+// Accept-Encoding header allows the coding, by name or
+// with *, and without a quality of zero.
+func acceptsEncoding(acceptEncoding, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		if value, hasQuality := strings.CutPrefix(strings.TrimSpace(params), "q="); hasQuality {
+			if number, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = number
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case coding:
+			return quality > 0
+		case "*":
+			wildcard = quality > 0
+		}
+	}
+	return wildcard
+}
+
+// The gzipResponseWriter compresses the body of the
+// successful responses with gzip. The other responses,
+// like 304 Not Modified, pass through.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer      *gzip.Writer
+	wroteHeader bool
+	compress    bool
+}
+
+// The WriteHeader method replaces the length of the file
+// with the gzip encoding for the successful responses.
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	if status == http.StatusOK {
+		gw.Header().Del("Content-Length")
+		gw.Header().Set("Content-Encoding", "gzip")
+		gw.compress = true
+	}
+	gw.ResponseWriter.WriteHeader(status)
+}
+
+// The Write method compresses the data. The gzip writer is
+// taken on the first write, so the responses without a
+// body (e.g. HEAD) have no gzip data either.
+func (gw *gzipResponseWriter) Write(data []byte) (int, error) {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if !gw.compress {
+		return gw.ResponseWriter.Write(data)
+	}
+	if gw.writer == nil {
+		gw.writer = gzipWriters.Get().(*gzip.Writer)
+		gw.writer.Reset(gw.ResponseWriter)
+	}
+	return gw.writer.Write(data)
+}
+
+// The Close method flushes the compressed data and returns
+// the gzip writer to the pool.
+func (gw *gzipResponseWriter) Close() error {
+	if gw.writer == nil {
+		return nil
+	}
+	err := gw.writer.Close()
+	gw.writer.Reset(io.Discard)
+	gzipWriters.Put(gw.writer)
+	gw.writer = nil
+	return err
+}
+
+// The Unwrap method returns the original ResponseWriter,
+// for http.ResponseController.
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// GzipStaticFiles writes a .gz copy, compressed with the
+// best compression, next to every file of a compressible
+// type under the root folder, so the static file server
+// sends it instead of compressing the file on every
+// request. The copies newer than their file are kept, and
+// the files which gzip does not make smaller are skipped.
+// It returns the number of copies written. It runs at
+// start up with the assets read from the disk, and with go
+// generate when the static folder is embedded.
+func GzipStaticFiles(root string) (int, error) {
+	written := 0
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		extension := filepath.Ext(filePath)
+		if extension == ".gz" || extension == ".br" || !isCompressible(mime.TypeByExtension(extension)) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		target := filePath + ".gz"
+		if targetInfo, err := os.Stat(target); err == nil && !targetInfo.ModTime().Before(info.ModTime()) {
+			return nil
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		var compressed bytes.Buffer
+		gzipWriter, err := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		gzipWriter.Write(content)
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+		if compressed.Len() >= len(content) {
+			// An outdated copy would be served instead of
+			// the file.
+			if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return nil
+		}
+		if err := replaceFile(target, compressed.Bytes(), info.Mode().Perm()); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	return written, err
+}
+
+// The replaceFile function writes the content to a
+// temporary file in the folder of target and renames it
+// to target, so the static file server never sends a
+// partial copy. The temporary file is removed on error.
+func replaceFile(target string, content []byte, perm fs.FileMode) (err error) {
+	temporary, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			temporary.Close()
+			os.Remove(temporary.Name())
+		}
+	}()
+	if _, err = temporary.Write(content); err != nil {
+		return err
+	}
+	if err = temporary.Chmod(perm); err != nil {
+		return err
+	}
+	if err = temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), target)
+}
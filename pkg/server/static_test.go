@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		coding         string
+		want           bool
+	}{
+		{"", "gzip", false},
+		{"gzip", "gzip", true},
+		{"gzip, deflate, br", "br", true},
+		{"GZIP", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.0", "gzip", false},
+		{"gzip;q=0.5", "gzip", true},
+		{"deflate", "gzip", false},
+		{"*", "br", true},
+		{"*;q=0", "br", false},
+		{"br;q=0, *", "br", false},
+		{"*, gzip;q=0", "gzip", false},
+		{"identity", "gzip", false},
+	}
+	for _, test := range tests {
+		if got := acceptsEncoding(test.acceptEncoding, test.coding); got != test.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", test.acceptEncoding, test.coding, got, test.want)
+		}
+	}
+}
+
+func TestGzipStaticFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"css/styles.css": strings.Repeat("body { margin: 0; }\n", 100),
+		"app.js":         strings.Repeat("console.log(1);\n", 100),
+		"tiny.txt":       "a",
+		"image.png":      strings.Repeat("x", 1000),
+	}
+	for name, content := range files {
+		filePath := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(filePath), 0o755)
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written, err := GzipStaticFiles(root)
+	if err != nil || written != 2 {
+		t.Fatalf("GzipStaticFiles = (%d, %v), want (2, nil)", written, err)
+	}
+	for name, want := range map[string]bool{"css/styles.css.gz": true, "app.js.gz": true, "tiny.txt.gz": false, "image.png.gz": false} {
+		if _, err := os.Stat(filepath.Join(root, name)); (err == nil) != want {
+			t.Errorf("the copy %s exists: %v, want %v", name, err == nil, want)
+		}
+	}
+	// The copies are up to date.
+	if written, err := GzipStaticFiles(root); err != nil || written != 0 {
+		t.Errorf("GzipStaticFiles again = (%d, %v), want (0, nil)", written, err)
+	}
+
+	// A copy which cannot be replaced fails without leaving
+	// the temporary file in the folder.
+	blocked := filepath.Join(root, "app.js.gz")
+	os.Remove(blocked)
+	if err := os.MkdirAll(filepath.Join(blocked, "inside"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(blocked, old, old)
+	if _, err := GzipStaticFiles(root); err == nil {
+		t.Error("GzipStaticFiles replaced a folder")
+	}
+	temporary, _ := filepath.Glob(filepath.Join(root, "*.tmp"))
+	if len(temporary) != 0 {
+		t.Errorf("GzipStaticFiles left the temporary files %v", temporary)
+	}
+}
+
+// The gzipped function returns the content compressed with
+// gzip.
+func gzipped(t *testing.T, content string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write([]byte(content))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// The readBody function returns the body of the response,
+// uncompressed when it is sent with gzip.
+func readBody(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	if recorder.Header().Get("Content-Encoding") != "gzip" {
+		return recorder.Body.String()
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestStaticHandler(t *testing.T) {
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	styles := strings.Repeat("body { margin: 0; }\n", 100)
+	script := strings.Repeat("console.log(1);\n", 100)
+	fsys := fstest.MapFS{
+		"styles.css":    {Data: []byte(styles), ModTime: modified},
+		"styles.css.br": {Data: []byte("brotli copy"), ModTime: modified},
+		"styles.css.gz": {Data: gzipped(t, "gzip copy"), ModTime: modified},
+		"old.css":       {Data: []byte(styles), ModTime: modified},
+		"old.css.br":    {Data: []byte("outdated copy"), ModTime: modified.Add(-time.Hour)},
+		"app.js":        {Data: []byte(script), ModTime: modified},
+		"small.css":     {Data: []byte("body {}"), ModTime: modified},
+	}
+	cssType, jsType := mime.TypeByExtension(".css"), mime.TypeByExtension(".js")
+
+	tests := []struct {
+		name     string
+		path     string
+		header   http.Header
+		status   int
+		encoding string
+		body     string
+		vary     bool
+	}{
+		{"brotli copy", "/styles.css", http.Header{"Accept-Encoding": {"gzip, br"}},
+			http.StatusOK, "br", "brotli copy", true},
+		{"gzip copy", "/styles.css", http.Header{"Accept-Encoding": {"gzip"}},
+			http.StatusOK, "gzip", "gzip copy", true},
+		{"no encoding", "/styles.css", nil,
+			http.StatusOK, "", styles, true},
+		// The outdated brotli copy is skipped, and the file is
+		// compressed on the fly instead.
+		{"outdated copy", "/old.css", http.Header{"Accept-Encoding": {"br, gzip"}},
+			http.StatusOK, "gzip", styles, true},
+		{"outdated copy only", "/old.css", http.Header{"Accept-Encoding": {"br"}},
+			http.StatusOK, "", styles, true},
+		{"on the fly", "/app.js", http.Header{"Accept-Encoding": {"gzip"}},
+			http.StatusOK, "gzip", script, true},
+		{"range", "/app.js", http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-6"}},
+			http.StatusPartialContent, "", script[:7], true},
+		{"not modified", "/app.js", http.Header{"Accept-Encoding": {"gzip"},
+			"If-Modified-Since": {modified.Format(http.TimeFormat)}},
+			http.StatusNotModified, "", "", true},
+		{"small file", "/small.css", http.Header{"Accept-Encoding": {"gzip"}},
+			http.StatusOK, "", "body {}", false},
+	}
+	handler := newStaticHandler(fsys, defaultStaticGzipMinSize)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, test.path, nil)
+			for key, values := range test.header {
+				request.Header[key] = values
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("the status is %d, want %d", recorder.Code, test.status)
+			}
+			if encoding := recorder.Header().Get("Content-Encoding"); encoding != test.encoding {
+				t.Errorf("the Content-Encoding is %q, want %q", encoding, test.encoding)
+			}
+			if body := readBody(t, recorder); body != test.body {
+				t.Errorf("the body has %d bytes starting with %.20q, want the %d bytes of %.20q",
+					len(body), body, len(test.body), test.body)
+			}
+			if vary := recorder.Header().Get("Vary") == "Accept-Encoding"; vary != test.vary {
+				t.Errorf("the Vary header is %q", recorder.Header().Get("Vary"))
+			}
+			// The copies have the content type of the file.
+			want := cssType
+			if strings.HasSuffix(test.path, ".js") {
+				want = jsType
+			}
+			if contentType := recorder.Header().Get("Content-Type"); test.status != http.StatusNotModified && contentType != want {
+				t.Errorf("the Content-Type is %q, want %q", contentType, want)
+			}
+		})
+	}
+}
+
+func TestStaticGzipMinSize(t *testing.T) {
+	script := strings.Repeat("console.log(1);\n", 100)
+	fsys := fstest.MapFS{"app.js": {Data: []byte(script)}}
+	tests := []struct {
+		name     string
+		minSize  int
+		encoding string
+	}{
+		{"default", defaultStaticGzipMinSize, "gzip"},
+		{"file size", len(script), "gzip"},
+		{"larger than the file", len(script) + 1, ""},
+		{"disabled", -1, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer("127.0.0.1:0", WithStaticGzipMinSize(test.minSize))
+			s.SetupStaticFS(fsys, "resources")
+			request := httptest.NewRequest(http.MethodGet, "/resources/app.js", nil)
+			request.Header.Set("Accept-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+			s.Handler().ServeHTTP(recorder, request)
+			if encoding := recorder.Header().Get("Content-Encoding"); encoding != test.encoding {
+				t.Errorf("the Content-Encoding is %q, want %q", encoding, test.encoding)
+			}
+			if body := readBody(t, recorder); recorder.Code != http.StatusOK || body != script {
+				t.Errorf("the file answered %d with %d bytes, want the %d bytes of the file", recorder.Code, len(body), len(script))
+			}
+		})
+	}
+}
@@ -0,0 +1,493 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// The routingTable holds the routing tree and the named
+// routes. A table is never modified once the router
+// publishes it: every change is applied to a new table
+// which replaces the current one atomically, so the
+// requests in progress keep using a consistent snapshot
+// without locks. The new table shares with the current one
+// the nodes and the names which the change does not touch.
+// The root holds the default routes and hosts the routes
+// of the virtual hosts, sorted by priority.
+type routingTable struct {
+	root  *node
+	hosts []*hostTable
+	names map[string]*Route
+	// gen is the generation of the table: the nodes of the
+	// same generation, and the names when ownsNames is
+	// set, belong to it and can be modified in place.
+	gen       uint64
+	ownsNames bool
+}
+
+// The newRoutingTable function creates an empty table.
+func newRoutingTable() *routingTable {
+	return &routingTable{
+		root:  newNode(segment{}),
+		names: make(map[string]*Route),
+	}
+}
+
+// The clone method returns a copy of the table of the
+// generation gen, which shares the tree and the names with
+// the table. The changes copy the nodes along the path
+// they modify the first time, see own, so a change costs
+// as much as the path of the route and not as much as the
+// whole table.
+func (t *routingTable) clone(gen uint64) *routingTable {
+	return &routingTable{
+		root:  t.root,
+		hosts: slices.Clone(t.hosts),
+		names: t.names,
+		gen:   gen,
+	}
+}
+
+// The own method returns the node if it belongs to the
+// generation of the table, or a copy of it which does. The
+// children of the copy are still shared.
+func (t *routingTable) own(n *node) *node {
+	if n.gen == t.gen {
+		return n
+	}
+	return &node{
+		seg:            n.seg,
+		staticChildren: maps.Clone(n.staticChildren),
+		paramChildren:  slices.Clone(n.paramChildren),
+		wildcardChild:  n.wildcardChild,
+		routes:         maps.Clone(n.routes),
+		gen:            t.gen,
+	}
+}
+
+// The ownChild method returns the child next of the
+// parent, owned by the table, replacing it in the parent
+// when it was copied. The parent must be owned already.
+func (t *routingTable) ownChild(parent, next *node) *node {
+	owned := t.own(next)
+	if owned != next {
+		parent.replaceChild(owned)
+	}
+	return owned
+}
+
+// The ownRoot method returns the root of the tree of the
+// host pattern, or the default one when host is empty,
+// owned by the table. It returns nil if the host pattern
+// has no tree.
+func (t *routingTable) ownRoot(host string) *node {
+	if host == "" {
+		t.root = t.own(t.root)
+		return t.root
+	}
+	for index, table := range t.hosts {
+		if table.pattern == host {
+			if table.root.gen != t.gen {
+				t.hosts[index] = &hostTable{pattern: table.pattern, labels: table.labels, root: t.own(table.root)}
+			}
+			return t.hosts[index].root
+		}
+	}
+	return nil
+}
+
+// The ownNames method makes the names map of the table a
+// copy of its own before it is modified.
+func (t *routingTable) ownNames() {
+	if !t.ownsNames {
+		t.names = maps.Clone(t.names)
+		t.ownsNames = true
+	}
+}
+
+// The existingRoot method returns the root of the tree
+// where the route is stored, or nil if its host has no
+// table.
+func (t *routingTable) existingRoot(rte *Route) *node {
+	if rte.host == "" {
+		return t.root
+	}
+	for _, host := range t.hosts {
+		if host.pattern == rte.host {
+			return host.root
+		}
+	}
+	return nil
+}
+
+// The isEmpty method reports whether the node has neither
+// routes nor children, so it can be pruned from the tree.
+func (n *node) isEmpty() bool {
+	return len(n.routes) == 0 && len(n.staticChildren) == 0 &&
+		len(n.paramChildren) == 0 && n.wildcardChild == nil
+}
+
+// The removeChild method deletes the child next from the
+// node.
+func (n *node) removeChild(next *node) {
+	switch next.seg.kind {
+	case staticSegment:
+		delete(n.staticChildren, next.seg.value)
+	case wildcardSegment:
+		n.wildcardChild = nil
+	default:
+		for index, child := range n.paramChildren {
+			if child == next {
+				n.paramChildren = append(n.paramChildren[:index], n.paramChildren[index+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// The replaceChild method puts next in the place of the
+// child of the node for the same segment.
+func (n *node) replaceChild(next *node) {
+	switch next.seg.kind {
+	case staticSegment:
+		n.staticChildren[next.seg.value] = next
+	case wildcardSegment:
+		n.wildcardChild = next
+	default:
+		for index, child := range n.paramChildren {
+			if child.seg.value == next.seg.value && child.seg.paramType == next.seg.paramType {
+				n.paramChildren[index] = next
+				return
+			}
+		}
+	}
+}
+
+// The find method returns the existing child of the node
+// for the segment seg, or nil.
+func (n *node) find(seg segment) *node {
+	switch seg.kind {
+	case staticSegment:
+		return n.staticChildren[seg.value]
+	case wildcardSegment:
+		return n.wildcardChild
+	}
+	for _, next := range n.paramChildren {
+		if next.seg.value == seg.value && next.seg.paramType == seg.paramType {
+			return next
+		}
+	}
+	return nil
+}
+
+// The check method returns an error if the route cannot
+// be inserted in the table, because its host pattern or
+// its pattern conflicts with the ones in the table or the
+// same route is already registered. It does not modify
+// the table, so a failed insert leaves no empty nodes.
+func (t *routingTable) check(rte *Route) error {
+	current := t.root
+	if rte.host != "" {
+		current = nil
+		for _, existing := range t.hosts {
+			if existing.pattern == rte.host {
+				current = existing.root
+				break
+			}
+			if shape(existing.labels) == shape(rte.hostLabels) {
+				return fmt.Errorf("host pattern %q conflicts with %q, use the same names", rte.host, existing.pattern)
+			}
+		}
+	}
+	for _, seg := range rte.segments {
+		if current == nil {
+			return nil
+		}
+		if err := current.conflict(seg); err != nil {
+			return fmt.Errorf("pattern %q: %w", rte.pattern, err)
+		}
+		current = current.find(seg)
+	}
+	if current == nil {
+		return nil
+	}
+	if previous, exists := current.routes[rte.method]; exists {
+		return fmt.Errorf("route %s %s is already registered as %s %s",
+			displayMethod(rte.method), rte.pattern, displayMethod(previous.method), previous.pattern)
+	}
+	return nil
+}
+
+// The insert method stores the route in the node of its
+// pattern, creating the missing nodes and copying the
+// shared ones along the path. It returns an error, and
+// leaves the table untouched, if the route cannot be
+// inserted (see check).
+func (t *routingTable) insert(rte *Route) error {
+	if err := t.check(rte); err != nil {
+		return err
+	}
+	if rte.host != "" {
+		t.hostTable(rte.host, rte.hostLabels)
+	}
+	current := t.ownRoot(rte.host)
+	for _, seg := range rte.segments {
+		if next := current.find(seg); next != nil {
+			current = t.ownChild(current, next)
+			continue
+		}
+		current = current.child(seg)
+		current.gen = t.gen
+	}
+	if current.routes == nil {
+		current.routes = make(map[string]*Route)
+	}
+	current.routes[rte.method] = rte
+	return nil
+}
+
+// The contains method reports whether the route is in the
+// table.
+func (t *routingTable) contains(rte *Route) bool {
+	current := t.existingRoot(rte)
+	if current == nil {
+		return false
+	}
+	for _, seg := range rte.segments {
+		if current = current.find(seg); current == nil {
+			return false
+		}
+	}
+	return current.routes[rte.method] == rte
+}
+
+// The remove method deletes the route from the table,
+// together with its name and the nodes left empty. It
+// returns false if the route is not in the table.
+func (t *routingTable) remove(rte *Route) bool {
+	if !t.contains(rte) {
+		return false
+	}
+	path := []*node{t.ownRoot(rte.host)}
+	for _, seg := range rte.segments {
+		parent := path[len(path)-1]
+		path = append(path, t.ownChild(parent, parent.find(seg)))
+	}
+	delete(path[len(path)-1].routes, rte.method)
+	for index := len(path) - 1; index > 0 && path[index].isEmpty(); index-- {
+		path[index-1].removeChild(path[index])
+	}
+	if rte.host != "" && path[0].isEmpty() {
+		for index, host := range t.hosts {
+			if host.pattern == rte.host {
+				t.hosts = append(t.hosts[:index], t.hosts[index+1:]...)
+				break
+			}
+		}
+	}
+	for name, named := range t.names {
+		if named == rte {
+			t.ownNames()
+			delete(t.names, name)
+		}
+	}
+	return true
+}
+
+// The update method applies change to a copy of the
+// current table and, if it succeeds, publishes the copy
+// with an atomic swap. The writers are serialized by a
+// mutex, while the readers never wait. If change fails
+// the current table is kept untouched.
+//
+// Before the router serves its first request (see start)
+// nobody reads the table, so the changes are applied in
+// place to a draft table, published once when it is
+// created. This way registering n routes at start up
+// costs O(n) and not O(n²), since the nodes with many
+// children are not copied for every route. A change must
+// then check everything before modifying the table, like
+// insert, remove and setName do.
+func (rt *router) update(change func(t *routingTable) error) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if !rt.started.Load() {
+		if rt.draft == nil || rt.draft != rt.table.Load() {
+			rt.draft = rt.table.Load().clone(rt.gen.Add(1))
+			rt.table.Store(rt.draft)
+		}
+		return change(rt.draft)
+	}
+	next := rt.table.Load().clone(rt.gen.Add(1))
+	if err := change(next); err != nil {
+		return err
+	}
+	rt.table.Store(next)
+	return nil
+}
+
+// The routeBatch collects the changes of the routing table
+// made through a batch group (see Group.Batch). They are
+// applied at once to a private copy of the table, so their
+// errors are found at once, and the router publishes them
+// together when the batch is committed.
+type routeBatch struct {
+	base    *routingTable
+	table   *routingTable
+	changes []func(t *routingTable) error
+	done    bool
+}
+
+// The start method tells the router that it serves
+// requests, so from now on every change is applied to a
+// copy of the table (see update). It waits for the change
+// in progress, if any.
+func (rt *router) start() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.started.Store(true)
+	rt.draft = nil
+}
+
+// The current method returns the current table for the
+// readers other than the requests, like URLFor. Before
+// the router starts, the draft table stops being modified
+// in place, so the table can be read while routes are
+// being registered.
+func (rt *router) current() *routingTable {
+	if !rt.started.Load() {
+		rt.mu.Lock()
+		rt.draft = nil
+		rt.mu.Unlock()
+	}
+	return rt.table.Load()
+}
+
+// The newBatch method starts a batch on the current table.
+// The draft table, if any, is not modified in place any
+// more, since the batch shares its nodes.
+func (rt *router) newBatch() *routeBatch {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.draft = nil
+	base := rt.table.Load()
+	return &routeBatch{base: base, table: base.clone(rt.gen.Add(1))}
+}
+
+// The write method applies change to the batch while it is
+// open, or publishes it at once with update when there is
+// no batch.
+func (rt *router) write(batch *routeBatch, change func(t *routingTable) error) error {
+	if batch == nil || batch.done {
+		return rt.update(change)
+	}
+	if err := change(batch.table); err != nil {
+		return err
+	}
+	batch.changes = append(batch.changes, change)
+	return nil
+}
+
+// The commit method closes the batch and publishes its
+// changes in a single swap. If the table did not change
+// since the batch started, the copy of the batch is
+// published as it is. Otherwise the changes are applied
+// again to the current table, and none is published if
+// one of them fails.
+func (rt *router) commit(batch *routeBatch) error {
+	batch.done = true
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	current := rt.table.Load()
+	if current == batch.base {
+		rt.table.Store(batch.table)
+		return nil
+	}
+	next := current.clone(rt.gen.Add(1))
+	for _, change := range batch.changes {
+		if err := change(next); err != nil {
+			return err
+		}
+	}
+	rt.table.Store(next)
+	return nil
+}
+
+// The newRoute method parses the pattern and creates a
+// route for the given HTTP method, in the tree of the host
+// pattern or in the default one when host is empty. The
+// handler function is wrapped by the middlewares, which
+// are kept in the route for the introspection. It returns
+// an error if the patterns are not valid.
+func (rt *router) newRoute(host, method, pattern string, handlerLogic http.HandlerFunc, middlewares []types.Middleware) (*Route, error) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var hostLabels []segment
+	if host != "" {
+		if hostLabels, err = parseHostPattern(host); err != nil {
+			return nil, err
+		}
+		host = strings.TrimSuffix(strings.ToLower(host), ".")
+		for _, label := range hostLabels {
+			for _, seg := range segments {
+				if label.kind == paramSegment && seg.kind != staticSegment && label.value == seg.value {
+					return nil, fmt.Errorf("pattern %q repeats the parameter %q of the host %q", pattern, seg.value, host)
+				}
+			}
+		}
+	}
+	return &Route{
+		router:       rt,
+		host:         host,
+		hostLabels:   hostLabels,
+		method:       method,
+		pattern:      pattern,
+		segments:     segments,
+		handlerLogic: chainMiddlewares(handlerLogic, middlewares),
+		middlewares:  middlewares,
+	}, nil
+}
+
+// The addRoute method creates a route (see newRoute) and
+// adds it to the routing table, or to the batch if one is
+// given. It returns the route, or an error if the patterns
+// are not valid or conflict with a route already
+// registered.
+func (rt *router) addRoute(batch *routeBatch, host, method, pattern string, handlerLogic http.HandlerFunc, middlewares []types.Middleware) (*Route, error) {
+	rte, err := rt.newRoute(host, method, pattern, handlerLogic, middlewares)
+	if err != nil {
+		return nil, err
+	}
+	rte.batch = batch
+	if err := rt.write(batch, func(t *routingTable) error {
+		return t.insert(rte)
+	}); err != nil {
+		return nil, err
+	}
+	return rte, nil
+}
+
+// The removeRoutes method deletes the routes from the
+// routing table in a single swap, or from the batch if one
+// is given. The routes which are not registered are
+// ignored. It returns how many routes were removed.
+func (rt *router) removeRoutes(batch *routeBatch, routes ...*Route) int {
+	removed := 0
+	rt.write(batch, func(t *routingTable) error {
+		removed = 0
+		for _, rte := range routes {
+			if t.remove(rte) {
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MetalbolicX/vanilla-go-webserver/pkg/types"
+)
+
+// defaultHSTSMaxAge is the time the browsers remember to
+// use only HTTPS with the server, two years as suggested
+// by https://hstspreload.org.
+const defaultHSTSMaxAge = 2 * 365 * 24 * time.Hour
+
+// The tlsSettings struct stores the HTTPS configuration of
+// the server. The certificate is read from certFile and
+// keyFile or, for local development, generated in memory
+// when selfSigned is true. When redirectAddr is set, a
+// plain HTTP listener on that address redirects to HTTPS.
+type tlsSettings struct {
+	certFile     string
+	keyFile      string
+	selfSigned   bool
+	minVersion   uint16
+	cipherSuites []uint16
+	redirectAddr string
+	hstsMaxAge   time.Duration
+}
+
+// WithTLS serves HTTPS with the certificate and private
+// key stored in PEM files.
+func WithTLS(certFile, keyFile string) Option {
+	return func(s *Server) {
+		s.tls.certFile = certFile
+		s.tls.keyFile = keyFile
+	}
+}
+
+// WithSelfSignedCertificate serves HTTPS with a certificate
+// for localhost generated in memory at start up. The
+// browsers do not trust it, so it is only meant for local
+// development.
+func WithSelfSignedCertificate() Option {
+	return func(s *Server) {
+		s.tls.selfSigned = true
+	}
+}
+
+// WithTLSMinVersion sets the minimum TLS version accepted,
+// e.g. tls.VersionTLS13. The default is TLS 1.2.
+func WithTLSMinVersion(version uint16) Option {
+	return func(s *Server) {
+		s.tls.minVersion = version
+	}
+}
+
+// WithTLSCipherSuites sets the cipher suites enabled for
+// TLS 1.2 and below, e.g. tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256.
+// The TLS 1.3 suites are not configurable.
+func WithTLSCipherSuites(suites ...uint16) Option {
+	return func(s *Server) {
+		s.tls.cipherSuites = suites
+	}
+}
+
+// WithHTTPSRedirect starts a plain HTTP listener on addr
+// (e.g., :80) which redirects every request to the same
+// URL with HTTPS.
+func WithHTTPSRedirect(addr string) Option {
+	return func(s *Server) {
+		s.tls.redirectAddr = addr
+	}
+}
+
+// WithHSTSMaxAge sets the max-age of the
+// Strict-Transport-Security header sent with HTTPS. Zero
+// disables the header.
+func WithHSTSMaxAge(maxAge time.Duration) Option {
+	return func(s *Server) {
+		s.tls.hstsMaxAge = maxAge
+	}
+}
+
+// The isTLS method reports whether the server is
+// configured to serve HTTPS.
+func (s *Server) isTLS() bool {
+	return s.tls.selfSigned || (s.tls.certFile != "" && s.tls.keyFile != "")
+}
+
+// The buildTLSConfig method loads or generates the
+// certificate and returns the TLS configuration of the
+// server.
+func (s *Server) buildTLSConfig() (*tls.Config, error) {
+	var certificate tls.Certificate
+	var err error
+	if s.tls.certFile != "" && s.tls.keyFile != "" {
+		certificate, err = tls.LoadX509KeyPair(s.tls.certFile, s.tls.keyFile)
+	} else {
+		certificate, err = selfSignedCertificate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   s.tls.minVersion,
+		CipherSuites: s.tls.cipherSuites,
+	}, nil
+}
+
+// The selfSignedCertificate function generates an ECDSA
+// key and a certificate valid for one year for localhost,
+// 127.0.0.1 and ::1.
+func selfSignedCertificate() (tls.Certificate, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"vanilla-go-webserver development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	certificateDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{certificateDER},
+		PrivateKey:  privateKey,
+	}, nil
+}
+
+// The hsts middleware adds the Strict-Transport-Security
+// header to every response, so the browsers keep using
+// HTTPS with the server.
+func hsts(maxAge time.Duration) types.Middleware {
+	value := fmt.Sprintf("max-age=%d; includeSubDomains", int(maxAge.Seconds()))
+	return func(nextHandler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Strict-Transport-Security", value)
+			nextHandler(w, r)
+		}
+	}
+}
+
+// The newRedirectServer method creates the plain HTTP
+// server which answers every request with a redirection
+// to the same host, path and query on the HTTPS port. The
+// GET and HEAD requests get 301 Moved Permanently and the
+// other methods 308 Permanent Redirect, which keeps the
+// method and the body.
+func (s *Server) newRedirectServer() *http.Server {
+	_, httpsPort, _ := net.SplitHostPort(s.port)
+	return &http.Server{
+		Addr:              s.tls.redirectAddr,
+		ReadHeaderTimeout: s.httpServer.ReadHeaderTimeout,
+		IdleTimeout:       s.httpServer.IdleTimeout,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if hostname, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = hostname
+			}
+			if httpsPort != "" && httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), redirectStatus(r.Method))
+		}),
+	}
+}
+
+// The startRedirectServer method starts the HTTP to HTTPS
+// redirection server, if it is configured, on the socket
+// passed by the previous process in a handoff or on a new
+// one, shared with SO_REUSEPORT by the prefork workers,
+// and sends the error that stops it to serveErr.
+func (s *Server) startRedirectServer(serveErr chan<- error) {
+	if s.redirectServer == nil {
+		return
+	}
+	listener := takeInherited(redirectListenerName)
+	if listener == nil {
+		var err error
+		if isPreforkWorker() {
+			listener, err = listenReusePort(s.redirectServer.Addr)
+		} else {
+			listener, err = net.Listen("tcp", s.redirectServer.Addr)
+		}
+		if err != nil {
+			serveErr <- err
+			return
+		}
+	}
+	s.redirectListener = listener
+	go func() {
+		serveErr <- s.redirectServer.Serve(listener)
+	}()
+}
+
+// The shutdownRedirectServer method stops the redirection
+// server, if it is running.
+func (s *Server) shutdownRedirectServer(ctx context.Context) error {
+	if s.redirectServer == nil {
+		return nil
+	}
+	return s.redirectServer.Shutdown(ctx)
+}
+
+// The tlsEnvOptions function reads the HTTPS configuration
+// from the environment variables:
+//
+//   - TLS_CERT_FILE and TLS_KEY_FILE, the PEM files of the
+//     certificate and its private key,
+//   - TLS_SELF_SIGNED, true to generate a development
+//     certificate when there are no files,
+//   - TLS_MIN_VERSION, 1.2 or 1.3,
+//   - TLS_CIPHER_SUITES, comma separated names of cipher
+//     suites (e.g., TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256),
+//   - TLS_REDIRECT_ADDR, the address of the HTTP listener
+//     which redirects to HTTPS (e.g., :80),
+//   - TLS_HSTS_MAX_AGE, a duration like 8760h, 0 disables
+//     the Strict-Transport-Security header.
+func tlsEnvOptions() ([]Option, error) {
+	options := make([]Option, 0)
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if certFile != "" {
+		options = append(options, WithTLS(certFile, keyFile))
+	}
+
+	if value := os.Getenv("TLS_SELF_SIGNED"); value != "" {
+		selfSigned, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("TLS_SELF_SIGNED: %w", err)
+		}
+		if selfSigned && certFile == "" {
+			options = append(options, WithSelfSignedCertificate())
+		}
+	}
+
+	switch version := os.Getenv("TLS_MIN_VERSION"); version {
+	case "":
+	case "1.2":
+		options = append(options, WithTLSMinVersion(tls.VersionTLS12))
+	case "1.3":
+		options = append(options, WithTLSMinVersion(tls.VersionTLS13))
+	default:
+		return nil, fmt.Errorf("TLS_MIN_VERSION: unsupported version %q, use 1.2 or 1.3", version)
+	}
+
+	if value := os.Getenv("TLS_CIPHER_SUITES"); value != "" {
+		suitesByName := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suitesByName[suite.Name] = suite.ID
+		}
+		suites := make([]uint16, 0)
+		for _, name := range strings.Split(value, ",") {
+			id, exists := suitesByName[strings.TrimSpace(name)]
+			if !exists {
+				return nil, fmt.Errorf("TLS_CIPHER_SUITES: unknown or insecure cipher suite %q", name)
+			}
+			suites = append(suites, id)
+		}
+		options = append(options, WithTLSCipherSuites(suites...))
+	}
+
+	if addr := os.Getenv("TLS_REDIRECT_ADDR"); addr != "" {
+		options = append(options, WithHTTPSRedirect(addr))
+	}
+
+	if value := os.Getenv("TLS_HSTS_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("TLS_HSTS_MAX_AGE: %w", err)
+		}
+		options = append(options, WithHSTSMaxAge(maxAge))
+	}
+
+	return options, nil
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHSTS(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{"plain HTTP", nil, ""},
+		{"default max-age", []Option{WithSelfSignedCertificate()}, "max-age=63072000; includeSubDomains"},
+		{"custom max-age", []Option{WithSelfSignedCertificate(), WithHSTSMaxAge(time.Hour)}, "max-age=3600; includeSubDomains"},
+		{"disabled", []Option{WithSelfSignedCertificate(), WithHSTSMaxAge(0)}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer("127.0.0.1:0", test.options...)
+			s.Handle(http.MethodGet, "/", noopHandler)
+			recorder := httptest.NewRecorder()
+			s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			if got := recorder.Header().Get("Strict-Transport-Security"); got != test.want {
+				t.Errorf("Strict-Transport-Security is %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	s := NewServer("127.0.0.1:0", WithSelfSignedCertificate(), WithTLSMinVersion(tls.VersionTLS13))
+	s.Handle(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	})
+	tlsConfig, err := s.buildTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion is %x, want TLS 1.3", tlsConfig.MinVersion)
+	}
+	certificate, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if err := certificate.VerifyHostname(host); err != nil {
+			t.Errorf("the self-signed certificate is not valid for %s: %v", host, err)
+		}
+	}
+
+	testServer := httptest.NewUnstartedServer(s.Handler())
+	testServer.TLS = tlsConfig
+	testServer.StartTLS()
+	defer testServer.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	response, err := client.Get(testServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if string(body) != "secure" || response.TLS == nil || response.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("the HTTPS request answered %q with %+v", body, response.TLS)
+	}
+
+	if _, err := NewServer(":0", WithTLS("missing.crt", "missing.key")).buildTLSConfig(); err == nil {
+		t.Error("buildTLSConfig with missing files returned no error")
+	}
+}
+
+func TestRedirectServer(t *testing.T) {
+	tests := []struct {
+		port, method, host, target string
+		wantStatus                 int
+		wantLocation               string
+	}{
+		{":443", http.MethodGet, "example.com", "/customer/1?tab=orders", http.StatusMovedPermanently, "https://example.com/customer/1?tab=orders"},
+		{":443", http.MethodHead, "example.com:80", "/", http.StatusMovedPermanently, "https://example.com/"},
+		{":443", http.MethodPost, "example.com", "/customer", http.StatusPermanentRedirect, "https://example.com/customer"},
+		{":8443", http.MethodGet, "example.com:8080", "/a%2Fb", http.StatusMovedPermanently, "https://example.com:8443/a%2Fb"},
+		{":8443", http.MethodDelete, "[::1]:8080", "/customer/1", http.StatusPermanentRedirect, "https://[::1]:8443/customer/1"},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.host+test.target, func(t *testing.T) {
+			s := NewServer(test.port, WithSelfSignedCertificate(), WithHTTPSRedirect(":0"))
+			request := httptest.NewRequest(test.method, test.target, nil)
+			request.Host = test.host
+			recorder := httptest.NewRecorder()
+			s.newRedirectServer().Handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.wantStatus || recorder.Header().Get("Location") != test.wantLocation {
+				t.Errorf("the redirect is %d to %q, want %d to %q",
+					recorder.Code, recorder.Header().Get("Location"), test.wantStatus, test.wantLocation)
+			}
+		})
+	}
+}
+
+func TestTLSEnvOptions(t *testing.T) {
+	t.Setenv("TLS_SELF_SIGNED", "true")
+	t.Setenv("TLS_MIN_VERSION", "1.3")
+	t.Setenv("TLS_CIPHER_SUITES", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256")
+	t.Setenv("TLS_REDIRECT_ADDR", ":8080")
+	t.Setenv("TLS_HSTS_MAX_AGE", "1h")
+	options, err := tlsEnvOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(":8443", options...)
+	if !s.isTLS() || !s.tls.selfSigned || s.tls.minVersion != tls.VersionTLS13 || len(s.tls.cipherSuites) != 2 ||
+		s.tls.redirectAddr != ":8080" || s.tls.hstsMaxAge != time.Hour {
+		t.Errorf("the environment gives the TLS settings %+v", s.tls)
+	}
+}
+
+func TestTLSEnvOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"certificate without key", map[string]string{"TLS_CERT_FILE": "server.crt"}},
+		{"key without certificate", map[string]string{"TLS_KEY_FILE": "server.key"}},
+		{"invalid self-signed", map[string]string{"TLS_SELF_SIGNED": "maybe"}},
+		{"unsupported version", map[string]string{"TLS_MIN_VERSION": "1.0"}},
+		{"unknown cipher suite", map[string]string{"TLS_CIPHER_SUITES": "TLS_RSA_WITH_RC4_128_SHA"}},
+		{"invalid max-age", map[string]string{"TLS_HSTS_MAX_AGE": "2y"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			if _, err := tlsEnvOptions(); err == nil {
+				t.Errorf("tlsEnvOptions with %v returned no error", test.env)
+			}
+		})
+	}
+}